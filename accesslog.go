@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// Returns a middleware that logs every request once served through the logger of the application, so that the access
+// log honors the configured format and level. The requests to the given paths, like the probes, are not logged.
+func accessLogMiddleware(skipPaths ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(skipPaths))
+	for _, path := range skipPaths {
+		skip[path] = true
+	}
+
+	return func(requestContext *gin.Context) {
+		start := time.Now()
+		path := requestContext.Request.URL.Path
+		requestContext.Next()
+		if skip[path] {
+			return
+		}
+
+		entry := log.WithFields(logrus.Fields{
+			"method":     requestContext.Request.Method,
+			"path":       path,
+			"status":     requestContext.Writer.Status(),
+			"latency":    time.Since(start).Seconds(),
+			"client_ip":  requestContext.ClientIP(),
+			"request_id": requestID(requestContext),
+		})
+		if len(requestContext.Errors) > 0 {
+			entry = entry.WithField("errors", requestContext.Errors.String())
+		}
+		entry.Info("request served")
+	}
+}
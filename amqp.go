@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"net"
+	"time"
+)
+
+// Forwarder that publishes the messages to an AMQP 0-9-1 broker, like RabbitMQ. Each message is published to the
+// configured exchange with the topic as routing key. A new connection is opened for each message.
+type amqpForwarder struct {
+	url      string
+	exchange string
+}
+
+// Creates a forwarder that publishes to the broker at the given amqp:// url through the given exchange. With the
+// default exchange, the empty one, the topic is the name of the queue the messages are delivered to.
+func newAMQPForwarder(url, exchange string) *amqpForwarder {
+	return &amqpForwarder{url: url, exchange: exchange}
+}
+
+// Opens a new connection to the broker. The network connection is closed as soon as ctx is done, which aborts any
+// handshake or publish in progress. The returned function must be called once the connection is no longer used.
+func (f *amqpForwarder) dial(ctx context.Context) (*amqp.Connection, func(), error) {
+	stop := func() {}
+	connection, err := amqp.DialConfig(f.url, amqp.Config{
+		Heartbeat: 10 * time.Second,
+		Locale:    "en_US",
+		Dial: func(network, addr string) (net.Conn, error) {
+			var dialer net.Dialer
+			netConn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			// The deadline only covers the handshake, the client clears it once the connection is open.
+			if err := netConn.SetDeadline(time.Now().Add(30 * time.Second)); err != nil {
+				return nil, err
+			}
+			stop = closeOnDone(ctx, netConn)
+			return netConn, nil
+		},
+	})
+	if err != nil {
+		stop()
+		return nil, nil, fmt.Errorf("%w: %w", errConnect, contextError(ctx, err))
+	}
+	return connection, stop, nil
+}
+
+// Publishes the body with the topic as routing key. The content-type and correlation-id headers are mapped to their
+// message properties and the rest of the headers are added to the message headers.
+func (f *amqpForwarder) Send(ctx context.Context, topic string, _ string, body []byte, headers map[string]string) error {
+	connection, stop, err := f.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	defer connection.Close()
+
+	channel, err := connection.Channel()
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer channel.Close()
+
+	publishing := amqp.Publishing{
+		Headers:   amqp.Table{},
+		Timestamp: time.Now(),
+		Body:      body,
+	}
+	for name, value := range headers {
+		switch name {
+		case "content-type":
+			publishing.ContentType = value
+		case "correlation-id":
+			publishing.CorrelationId = value
+		default:
+			publishing.Headers[name] = value
+		}
+	}
+
+	sendStart := time.Now()
+	err = channel.PublishWithContext(ctx, f.exchange, topic, false, false, publishing)
+	observeSend(ctx, sendStart, err)
+	return contextError(ctx, err)
+}
+
+// Connects to the broker and closes the connection right away.
+func (f *amqpForwarder) Check(ctx context.Context) error {
+	connection, stop, err := f.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	return contextError(ctx, connection.Close())
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// The credentials required to post alerts, either a bearer token, basic auth credentials, or both.
+type credentials struct {
+	token string
+	user  string
+	pass  string
+}
+
+// Returns the credentials configured with the auth flags.
+func flagCredentials() credentials {
+	return credentials{token: *authToken, user: *authUser, pass: *authPass}
+}
+
+// Returns whether any credentials are configured, either a bearer token or a basic auth user.
+func authEnabled() bool {
+	return flagCredentials().enabled()
+}
+
+// Returns whether the credentials require any auth, either a bearer token or a basic auth user.
+func (c credentials) enabled() bool {
+	return c.token != "" || c.user != ""
+}
+
+// Returns the handlers of a route. When the route is protected and credentials are configured, the handler is
+// preceded by the auth middleware so that the auth can be applied route by route instead of globally.
+func withAuth(protected bool, handler gin.HandlerFunc) []gin.HandlerFunc {
+	if !protected {
+		return []gin.HandlerFunc{handler}
+	}
+	return withCredentials(flagCredentials(), handler)
+}
+
+// Returns the handlers of a route protected by the given credentials, the handler preceded by the auth middleware
+// unless the credentials require no auth.
+func withCredentials(creds credentials, handler gin.HandlerFunc) []gin.HandlerFunc {
+	if creds.enabled() {
+		return []gin.HandlerFunc{authMiddleware(creds), handler}
+	}
+	return []gin.HandlerFunc{handler}
+}
+
+// Middleware that answers with a 401 to the requests that do not carry the given bearer token or basic auth
+// credentials.
+func authMiddleware(creds credentials) gin.HandlerFunc {
+	return func(requestContext *gin.Context) {
+		if !creds.authorized(requestContext.Request) {
+			if creds.user != "" {
+				requestContext.Header("WWW-Authenticate", `Basic realm="alertmanager-stomp-forwarder"`)
+			} else {
+				requestContext.Header("WWW-Authenticate", "Bearer")
+			}
+			requestContext.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		requestContext.Next()
+	}
+}
+
+// Checks the credentials of a request against these ones. Any of the configured methods is enough to be authorized.
+// The comparisons are done in constant time to not leak the credentials through timing.
+func (c credentials) authorized(request *http.Request) bool {
+	if c.token != "" {
+		token, ok := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(c.token)) == 1 {
+			return true
+		}
+	}
+	if c.user != "" {
+		user, pass, ok := request.BasicAuth()
+		if ok && subtle.ConstantTimeCompare([]byte(user), []byte(c.user)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(pass), []byte(c.pass)) == 1 {
+			return true
+		}
+	}
+	return false
+}
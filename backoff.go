@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Exponential backoff between the attempts of an operation, doubling the delay on every attempt up to a maximum. A
+// fraction of each delay, the jitter, is randomized so that the replicas retrying at the same time, for instance when
+// the broker restarts, spread their attempts instead of all hitting the broker at once. With a jitter of 1, the full
+// jitter, the delays are picked at random between 0 and the exponential delay.
+type backoff struct {
+	initial time.Duration
+	max     time.Duration
+	jitter  float64
+	attempt int
+}
+
+// Returns the delay to wait before the next attempt.
+func (b *backoff) next() time.Duration {
+	delay := b.initial << b.attempt
+	if delay > b.max || delay <= 0 {
+		delay = b.max
+	} else {
+		b.attempt++
+	}
+	randomized := time.Duration(b.jitter * float64(delay))
+	return delay - randomized + time.Duration(rand.Int63n(int64(randomized)+1))
+}
+
+// Waits the delay before the next attempt. Returns false, without waiting the whole delay, when ctx is done first.
+func (b *backoff) wait(ctx context.Context) bool {
+	timer := time.NewTimer(b.next())
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffNext(t *testing.T) {
+	exponential := []time.Duration{
+		100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond,
+		time.Second, time.Second, time.Second,
+	}
+	tests := []struct {
+		name   string
+		jitter float64
+	}{
+		{name: "no jitter", jitter: 0},
+		{name: "half jitter", jitter: 0.5},
+		{name: "full jitter", jitter: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Several rounds, as the delays are random with a jitter.
+			for round := 0; round < 100; round++ {
+				delays := backoff{initial: 100 * time.Millisecond, max: time.Second, jitter: test.jitter}
+				for attempt, want := range exponential {
+					delay := delays.next()
+					low := want - time.Duration(test.jitter*float64(want))
+					if delay < low || delay > want {
+						t.Fatalf("attempt %d: delay %s out of [%s, %s]", attempt+1, delay, low, want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"hash/fnv"
+)
+
+// Content type of the messages holding a batch of alerts as newline delimited json.
+const ndjsonContentType = "application/x-ndjson"
+
+// Sends the alerts of a webhook to each of the destinations in a single message, recording the outcome of every send
+// in the activeMQ metrics, like forwardAlert does for a single alert. Returns the errors of the destinations the batch
+// didn't reach, if any.
+func forwardBatch(ctx context.Context, logger *logrus.Entry, destinations []string, alerts []Alert,
+	correlationID string, headers map[string]string) error {
+	logger = logger.WithField("correlation_id", correlationID)
+	return forwardToDestinations(logger, destinations, func(destination string) error {
+		return sendBatchToStomp(ctx, logger, destination, alerts, correlationID, headers)
+	})
+}
+
+// Sends the alerts to the topic in a single message formatted as the batch format, either a json array or newline
+// delimited json. The message carries the correlation id of the webhook and its group key as key, along with the given
+// headers.
+func sendBatchToStomp(ctx context.Context, logger *logrus.Entry, topic string, alerts []Alert, correlationID string,
+	headers map[string]string) (err error) {
+	ctx, span := tracer.Start(ctx, "send batch", trace.WithAttributes(
+		attribute.String("topic", topic),
+		attribute.Int("alert.count", len(alerts)),
+	))
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	logger = logger.WithField("topic", topic)
+	batch := make([]Alert, len(alerts))
+	keys := make([]string, len(alerts))
+	for i, alert := range alerts {
+		alertFingerprint := fingerprint(alert.Labels)
+		if *injectFingerprint {
+			alert.Fingerprint = alertFingerprint
+		}
+		if *includeTopic {
+			alert.Topic = topic
+		}
+		batch[i] = alert
+		keys[i] = idempotencyKey(alert, alertFingerprint)
+	}
+	message, err := marshalBatch(batch, *batchFormat)
+	if err != nil {
+		logger.Errorf("error while marshalling the batch of alerts: %v", err)
+		return err
+	}
+
+	logger.Infof("forwarding a batch of %d alerts to the broker", len(batch))
+	contentType := *stompContentType
+	if *batchFormat == "ndjson" {
+		contentType = ndjsonContentType
+	}
+	messageHeaders := map[string]string{
+		"content-type":   contentType,
+		"correlation-id": correlationID,
+	}
+	if *enableBrokerDedup {
+		messageHeaders[*dedupHeader] = batchIdempotencyKey(keys)
+	}
+	return sendMessage(ctx, logger, topic, headers["group-key"], message, messageHeaders, headers)
+}
+
+// Marshals the alerts in a single message, either as a json array of the alerts or, with the ndjson format, as their
+// compact json one per line, so that the consumers can still parse them one by one.
+func marshalBatch(alerts []Alert, format string) ([]byte, error) {
+	var batch bytes.Buffer
+	if format == "json-array" {
+		batch.WriteByte('[')
+	}
+	for i, alert := range alerts {
+		message, release, err := marshalAlert(alert)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case format == "json-array" && i > 0:
+			batch.WriteByte(',')
+		case format == "ndjson" && i > 0:
+			batch.WriteByte('\n')
+		}
+		if format == "ndjson" {
+			err = json.Compact(&batch, message)
+		} else {
+			_, err = batch.Write(message)
+		}
+		release()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if format == "json-array" {
+		batch.WriteByte(']')
+	}
+	return batch.Bytes(), nil
+}
+
+// Returns the idempotency key of a batch of alerts, the hash of the idempotency keys of its alerts, so that the broker
+// drops a batch sent again with the same alerts.
+func batchIdempotencyKey(keys []string) string {
+	hash := fnv.New64a()
+	for _, key := range keys {
+		_, _ = hash.Write([]byte(key))
+		_, _ = hash.Write([]byte{labelSeparator})
+	}
+	return fmt.Sprintf("%016x", hash.Sum64())
+}
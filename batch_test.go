@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/go-stomp/stomp/frame"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBatchBrokerClosesMidSend(t *testing.T) {
+	broker := newFakeBroker(t)
+	previousForwarder, previousFormat := forwarder, *batchFormat
+	forwarder = newStompForwarder(broker.addr(), "", "", "", "", "tcp", "auto", 0, 0, false, "")
+	*batchFormat = "json-array"
+	defer func() { forwarder, *batchFormat = previousForwarder, previousFormat }()
+	router := createConfiguredRouter()
+	body := `{"version":"4","status":"firing","groupKey":"{}:{alertname=\"HighLatency\"}","alerts":[` +
+		`{"status":"firing","labels":{"alertname":"HighLatency","instance":"api-1"}},` +
+		`{"status":"firing","labels":{"alertname":"HighLatency","instance":"api-2"}}]}`
+	post := func() int {
+		request := httptest.NewRequest(http.MethodPost, "/alerts/alerts", strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	// The broker closes the connection right after reading the batch, before acknowledging it.
+	broker.dropAfterSend.Store(true)
+	if code := post(); code != http.StatusInternalServerError {
+		t.Fatalf("status with the connection closed mid-send = %d, want %d", code, http.StatusInternalServerError)
+	}
+
+	// Alertmanager retries the whole batch on a new connection.
+	broker.dropAfterSend.Store(false)
+	if code := post(); code != http.StatusOK {
+		t.Fatalf("status of the retry = %d, want %d", code, http.StatusOK)
+	}
+
+	if connects := broker.received(frame.CONNECT); len(connects) != 2 {
+		t.Errorf("got %d connections, want one for each attempt", len(connects))
+	}
+	for _, command := range []string{frame.BEGIN, frame.COMMIT, frame.ABORT} {
+		if frames := broker.received(command); len(frames) > 0 {
+			t.Errorf("got %d %s frames, want no transaction", len(frames), command)
+		}
+	}
+	// At-least-once: the batch read before the connection closed is delivered again by the retry, and only then.
+	sends := broker.received(frame.SEND)
+	if len(sends) != 2 {
+		t.Fatalf("got %d SEND frames, want one for each attempt", len(sends))
+	}
+	for i, send := range sends {
+		var alerts []Alert
+		if err := json.Unmarshal(send.Body, &alerts); err != nil {
+			t.Fatalf("SEND frame %d is not a json array of alerts: %s", i+1, err)
+		}
+		if len(alerts) != 2 {
+			t.Errorf("SEND frame %d holds %d alerts, want the whole batch of 2", i+1, len(alerts))
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+// The states of a circuit breaker, as exposed in the circuit breaker state gauge.
+const (
+	breakerClosed   = 0
+	breakerOpen     = 1
+	breakerHalfOpen = 2
+)
+
+// Returned, wrapped, when an alert is not sent to a destination because its circuit breaker is open.
+var errCircuitOpen = errors.New("circuit breaker open")
+
+// The circuit breakers of the destinations, nil when they are disabled.
+var destinationBreakers *circuitBreakers
+
+var circuitBreakerState = metricsFactory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "stomp_circuit_breaker_state",
+	Help: "State of the circuit breaker of each destination, closed (0), open (1) or half-open (2).",
+}, []string{"destination"})
+
+// Circuit breakers keyed by destination, so that a destination that keeps failing stops being sent to without
+// affecting the healthy ones. A breaker opens after threshold consecutive failures and, once the cooldown elapses, lets
+// a single send through: the breaker closes if it succeeds and opens again for another cooldown otherwise.
+type circuitBreakers struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	breakers  map[string]*circuitBreaker
+}
+
+// The circuit breaker of a destination.
+type circuitBreaker struct {
+	state    int
+	failures int
+	openedAt time.Time
+}
+
+// Creates the circuit breakers opening after threshold consecutive failures for the given cooldown.
+func newCircuitBreakers(threshold int, cooldown time.Duration) *circuitBreakers {
+	return &circuitBreakers{
+		threshold: threshold,
+		cooldown:  cooldown,
+		breakers:  make(map[string]*circuitBreaker),
+	}
+}
+
+// Returns whether an alert can be sent to the destination at now. Once the cooldown of an open breaker elapses, the
+// breaker turns half-open and only the first send is allowed until its outcome is recorded, or until another cooldown
+// elapses, should the send be cancelled before.
+func (b *circuitBreakers) allow(destination string, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	breaker, ok := b.breakers[destination]
+	if !ok || breaker.state == breakerClosed {
+		return true
+	}
+	if now.Sub(breaker.openedAt) >= b.cooldown {
+		breaker.openedAt = now
+		b.setState(destination, breaker, breakerHalfOpen)
+		return true
+	}
+	return false
+}
+
+// Records the outcome of a send to the destination at now, opening its breaker when it failed threshold times in a row
+// or while half-open, and closing it when it succeeded.
+func (b *circuitBreakers) record(destination string, err error, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	breaker, ok := b.breakers[destination]
+	if !ok {
+		if err == nil {
+			return
+		}
+		breaker = &circuitBreaker{}
+		b.breakers[destination] = breaker
+	}
+	if err == nil {
+		breaker.failures = 0
+		b.setState(destination, breaker, breakerClosed)
+		return
+	}
+	breaker.failures++
+	if breaker.state == breakerHalfOpen || breaker.failures >= b.threshold {
+		breaker.openedAt = now
+		b.setState(destination, breaker, breakerOpen)
+	}
+}
+
+// Sets the state of the breaker of the destination, logging and exposing the change.
+func (b *circuitBreakers) setState(destination string, breaker *circuitBreaker, state int) {
+	if breaker.state == state {
+		return
+	}
+	breaker.state = state
+	circuitBreakerState.WithLabelValues(destination).Set(float64(state))
+	switch state {
+	case breakerOpen:
+		log.WithField("topic", destination).Warnf("circuit breaker opened after %d consecutive failures, not sending "+
+			"to the destination for %s", breaker.failures, b.cooldown)
+	case breakerClosed:
+		log.WithField("topic", destination).Infof("circuit breaker closed, the destination is sent to again")
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerIgnoresQueuedMessages(t *testing.T) {
+	defer func(breakers *circuitBreakers) { destinationBreakers = breakers }(destinationBreakers)
+	destinationBreakers = newCircuitBreakers(1, time.Hour)
+
+	queued := func(string) error { return fmt.Errorf("%w: %w", errQueued, errConnect) }
+	for i := 0; i < 3; i++ {
+		if err := forwardToDestinations(log.WithField("test", t.Name()), []string{"queued"}, queued); err != nil {
+			t.Fatalf("send %d: the queued message failed: %s", i+1, err)
+		}
+	}
+	if !destinationBreakers.allow("queued", time.Now()) {
+		t.Errorf("the breaker opened on queued messages")
+	}
+
+	failing := func(string) error { return errConnect }
+	if err := forwardToDestinations(log.WithField("test", t.Name()), []string{"failing"}, failing); err == nil {
+		t.Fatalf("the failed send returned no error")
+	}
+	if destinationBreakers.allow("failing", time.Now()) {
+		t.Errorf("the breaker didn't open on a failed send")
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// The origins allowed to post to the webhooks from a browser, parsed from the cors-allowed-origins flag. CORS is
+// disabled when empty.
+var corsAllowedOrigins []string
+
+// Returns a middleware that lets the browsers of the given origins, or of any origin when one of them is *, post to
+// the webhooks. The requests of an allowed origin are answered with the Access-Control-Allow-* headers, and their
+// preflight requests are answered right away with a 204. The requests of any other origin get no CORS headers, so the
+// browser blocks them.
+func corsMiddleware(origins []string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[origin] = true
+	}
+
+	return func(requestContext *gin.Context) {
+		origin := requestContext.GetHeader("Origin")
+		if origin == "" || (!allowed["*"] && !allowed[origin]) {
+			requestContext.Next()
+			return
+		}
+
+		requestContext.Header("Access-Control-Allow-Origin", origin)
+		requestContext.Header("Vary", "Origin")
+		requestContext.Header("Access-Control-Expose-Headers", requestIDHeader)
+		if requestContext.Request.Method == http.MethodOptions &&
+			requestContext.GetHeader("Access-Control-Request-Method") != "" {
+			requestContext.Header("Access-Control-Allow-Methods", webhookAllowedMethods)
+			requestContext.Header("Access-Control-Allow-Headers", "Authorization, Content-Type, "+requestIDHeader)
+			requestContext.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		requestContext.Next()
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Cache of the alerts forwarded recently, used to skip the identical alerts Alertmanager sends again within the
+// dedup window. It is bounded: once it holds size entries the least recently forwarded one is evicted, so memory stays
+// capped during an alert storm.
+type dedupCache struct {
+	mu      sync.Mutex
+	window  time.Duration
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+// A key of the dedup cache along with the time its alert was forwarded.
+type dedupEntry struct {
+	key       string
+	forwarded time.Time
+}
+
+// Byte written between the label names and values when computing a fingerprint. It can not occur in valid UTF-8.
+const labelSeparator = 0xff
+
+// The dedup cache, nil when dedup is disabled.
+var alertsDedup *dedupCache
+
+// Creates a dedup cache that remembers at most size alerts for the given window.
+func newDedupCache(window time.Duration, size int) *dedupCache {
+	return &dedupCache{
+		window:  window,
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Returns whether an alert with the given key was forwarded within the window before now.
+func (c *dedupCache) isDuplicate(key string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return false
+	}
+	return now.Sub(element.Value.(*dedupEntry).forwarded) < c.window
+}
+
+// Records that an alert with the given key was forwarded at the given time, evicting the least recently forwarded
+// alert when the cache is full.
+func (c *dedupCache) record(key string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*dedupEntry).forwarded = now
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&dedupEntry{key: key, forwarded: now})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*dedupEntry).key)
+	}
+}
+
+// Returns the dedup key of an alert. It is made of the fingerprint of its labels and its end time, so that the
+// resolution of an alert is not taken for a duplicate of its firing notification.
+func dedupKey(alert Alert) string {
+	return fingerprint(alert.Labels) + "/" + alert.EndsAt
+}
+
+// Returns the idempotency key of an alert, set in the broker dedup header so that the broker drops the messages of an
+// alert it already received, as those sent again when Alertmanager retries a webhook that partially succeeded. It is
+// made of the fingerprint of its labels and its start and end times: Alertmanager sends a zero end time while the alert
+// fires, so its repeats share the key, while its resolution, and any later firing, gets a new one.
+func idempotencyKey(alert Alert, alertFingerprint string) string {
+	return alertFingerprint + "/" + alert.StartsAt + "/" + alert.EndsAt
+}
+
+// Computes the fingerprint of a label set, hashing with FNV-1a the label names and values sorted by name. It's the same
+// fingerprint Alertmanager computes for an alert, so consumers can correlate the messages with Alertmanager.
+func fingerprint(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := fnv.New64a()
+	for _, name := range names {
+		_, _ = hash.Write([]byte(name))
+		_, _ = hash.Write([]byte{labelSeparator})
+		_, _ = hash.Write([]byte(labels[name]))
+		_, _ = hash.Write([]byte{labelSeparator})
+	}
+	return fmt.Sprintf("%016x", hash.Sum64())
+}
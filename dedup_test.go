@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/prometheus/common/model"
+	"testing"
+)
+
+func TestFingerprintMatchesAlertmanager(t *testing.T) {
+	tests := []map[string]string{
+		{},
+		{"alertname": "HighLatency"},
+		{"alertname": "HighLatency", "severity": "critical", "instance": "host-1:9100"},
+		{"alertname": "DiskFull", "mountpoint": "/", "job": "node", "empty": ""},
+		{"alertname": "Unicode", "summary": "désolé ☃"},
+	}
+	for _, labels := range tests {
+		labelSet := model.LabelSet{}
+		for name, value := range labels {
+			labelSet[model.LabelName(name)] = model.LabelValue(value)
+		}
+		if got, want := fingerprint(labels), labelSet.Fingerprint().String(); got != want {
+			t.Errorf("fingerprint(%v) = %s, want %s", labels, got, want)
+		}
+	}
+}
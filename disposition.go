@@ -0,0 +1,46 @@
+package main
+
+// The actions taken on the alerts of a webhook, reported in the response under debug mode.
+const (
+	actionForwarded = "forwarded"
+	actionDropped   = "dropped"
+	actionDeduped   = "deduped"
+	actionFailed    = "failed"
+)
+
+// What was done with an alert of a webhook and why. Under debug mode the responses of the webhook list the disposition
+// of each of its alerts, so that the reason why a consumer didn't get an alert can be told without going through the
+// logs.
+type alertDisposition struct {
+	AlertName string `json:"alertname"`
+	Action    string `json:"action"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Returns the disposition as a line of plain text, like HighLatency: deduped (already forwarded within the dedup
+// window).
+func (d alertDisposition) String() string {
+	if d.Reason == "" {
+		return d.AlertName + ": " + d.Action
+	}
+	return d.AlertName + ": " + d.Action + " (" + d.Reason + ")"
+}
+
+// Collects the dispositions of the alerts of a webhook. They are only collected under debug mode, otherwise the
+// responses stay minimal and nothing is allocated for them.
+type alertDispositions []alertDisposition
+
+// Records the action taken on the alert and its reason, if any.
+func (d *alertDispositions) add(alert Alert, action string, reason string) {
+	if !*debug {
+		return
+	}
+	*d = append(*d, alertDisposition{AlertName: alert.Labels["alertname"], Action: action, Reason: reason})
+}
+
+// Records the same action and reason for every one of the alerts.
+func (d *alertDispositions) addAll(alerts []Alert, action string, reason string) {
+	for _, alert := range alerts {
+		d.add(alert, action, reason)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// The content encodings the bodies of the webhooks are accepted in. Identity stands for the bodies sent as they are.
+const (
+	encodingIdentity = "identity"
+	encodingGzip     = "gzip"
+	encodingSnappy   = "snappy"
+)
+
+var (
+	requestEncodings = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_request_encoding_total",
+		Help: "Total number of alert requests by the content encoding of their body, identity for the plain ones",
+	}, []string{"encoding"})
+
+	// Returned, wrapped, when the body of a webhook is not valid in its content encoding.
+	errInvalidEncoding = errors.New("invalid encoded body")
+)
+
+// Returns the content encoding of a webhook from its Content-Encoding header, identity when it has none, and whether
+// it's one of the accepted ones.
+func contentEncoding(header string) (string, bool) {
+	encoding := strings.ToLower(strings.TrimSpace(header))
+	switch encoding {
+	case "", encodingIdentity:
+		return encodingIdentity, true
+	case encodingGzip, "x-gzip":
+		return encodingGzip, true
+	case encodingSnappy:
+		return encodingSnappy, true
+	}
+	return encoding, false
+}
+
+// Returns a reader of the body of a webhook decoded from its content encoding, failing once the decoded body is
+// larger than maxBytes, like http.MaxBytesReader, so a small compressed body can't expand without bound. Gzip is
+// decoded as it's read, while snappy, in the block format of the Prometheus remote write, is read and decoded whole.
+func decodeBody(writer http.ResponseWriter, body io.Reader, encoding string, maxBytes int64) (io.Reader, error) {
+	switch encoding {
+	case encodingGzip:
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidEncoding, err)
+		}
+		return http.MaxBytesReader(writer, reader, maxBytes), nil
+	case encodingSnappy:
+		compressed, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		length, err := snappy.DecodedLen(compressed)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidEncoding, err)
+		}
+		if int64(length) > maxBytes {
+			return nil, &http.MaxBytesError{Limit: maxBytes}
+		}
+		decoded, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidEncoding, err)
+		}
+		return bytes.NewReader(decoded), nil
+	}
+	return body, nil
+}
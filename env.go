@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"os"
+)
+
+// Expands the references to environment variables, like ${BROKER_PASSWORD}, in the values of the flags of the
+// application, so that they can be taken from other variables, as the secrets of a deployment. Returns the names of
+// the flags whose value changed, never the values themselves, as they may be secrets. The values of the repeatable
+// string flags are expanded one by one, while the other repeatable flags are left as they are.
+func expandEnvFlags(application *kingpin.Application) ([]string, error) {
+	var expanded []string
+	for _, flag := range application.Model().Flags {
+		if repeatable, ok := flag.Value.(interface{ IsCumulative() bool }); ok && repeatable.IsCumulative() {
+			if expandEnvValues(flag.Value) {
+				expanded = append(expanded, flag.Name)
+			}
+			continue
+		}
+		value := flag.Value.String()
+		expandedValue := os.ExpandEnv(value)
+		if expandedValue == value {
+			continue
+		}
+		if err := flag.Value.Set(expandedValue); err != nil {
+			return nil, fmt.Errorf("--%s: %w", flag.Name, err)
+		}
+		expanded = append(expanded, flag.Name)
+	}
+	return expanded, nil
+}
+
+// Expands the references to environment variables in each of the values of a repeatable string flag, in place, and
+// returns whether any of them changed. Going through Set would append the joined values as one more value instead.
+func expandEnvValues(flagValue kingpin.Value) bool {
+	getter, ok := flagValue.(kingpin.Getter)
+	if !ok {
+		return false
+	}
+	values, ok := getter.Get().(*[]string)
+	if !ok {
+		return false
+	}
+	changed := false
+	for i, value := range *values {
+		if expandedValue := os.ExpandEnv(value); expandedValue != value {
+			(*values)[i] = expandedValue
+			changed = true
+		}
+	}
+	return changed
+}
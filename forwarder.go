@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"sort"
+	"time"
+)
+
+// Forwarder publishes the messages to a broker. There is an implementation for each of the backends the alerts can be
+// forwarded to, selected with the backend flag.
+type Forwarder interface {
+	// Send publishes the body to the topic along with the given headers. The content-type header is mapped to the
+	// native content type of the backend, if any. The key identifies the alert of the message, it is only used by
+	// the backends that partition the topics. The send is aborted as soon as ctx is done.
+	Send(ctx context.Context, topic string, key string, body []byte, headers map[string]string) error
+
+	// Check verifies the broker is reachable and accepts the configured credentials.
+	Check(ctx context.Context) error
+}
+
+var (
+	// The forwarder of the configured backend.
+	forwarder Forwarder
+
+	// Returned, wrapped, by the forwarders when the connection to the broker could not be established.
+	errConnect = errors.New("connection to the broker failed")
+
+	// Returned, wrapped, by the forwarders when a write to the broker did not complete within the write timeout.
+	errWriteTimeout = errors.New("write to the broker timed out")
+)
+
+// Creates the forwarder of the given backend from the parsed config.
+func newForwarder(backend string) (Forwarder, error) {
+	var backendForwarder Forwarder
+	switch backend {
+	case "stomp":
+		user, pass := *stompUser, *stompPass
+		if *stompAnonymous {
+			user, pass = "", ""
+		}
+		backendForwarder = newStompForwarder(*stompAddr, user, pass, *stompVHost, *stompClientID, *stompTransport,
+			*stompVersion, *stompWriteTimeout, *stompTCPKeepAlive, *stompNoContentLength, *artemisRoutingType)
+	case "amqp":
+		backendForwarder = newAMQPForwarder(*amqpURL, *amqpExchange)
+	case "kafka":
+		kafkaForwarder, err := newKafkaForwarder(splitList(*kafkaBrokers), *kafkaSASLMechanism, *kafkaSASLUser,
+			*kafkaSASLPass, *kafkaTLS)
+		if err != nil {
+			return nil, err
+		}
+		backendForwarder = kafkaForwarder
+	default:
+		return nil, fmt.Errorf("unknown backend [%s]", backend)
+	}
+
+	if *dryRun {
+		return dryRunForwarder{}, nil
+	}
+	return withReconnects(backendForwarder), nil
+}
+
+// Creates a forwarder publishing to the stomp server at addr with the given credentials and the rest of the stomp
+// options of the flags, or the one of the dry-run mode when it's enabled.
+func newStompForwarderTo(addr, user, pass string) Forwarder {
+	if *dryRun {
+		return dryRunForwarder{}
+	}
+	return withReconnects(newStompForwarder(addr, user, pass, *stompVHost, *stompClientID, *stompTransport,
+		*stompVersion, *stompWriteTimeout, *stompTCPKeepAlive, *stompNoContentLength, *artemisRoutingType))
+}
+
+// Wraps the forwarder so that it connects again to the broker when the connection fails, unless reconnects are
+// disabled.
+func withReconnects(backendForwarder Forwarder) Forwarder {
+	if *reconnectAttempts > 0 {
+		return &reconnectingForwarder{Forwarder: backendForwarder, attempts: *reconnectAttempts}
+	}
+	return backendForwarder
+}
+
+// Forwarder that connects again to the broker, waiting a jittered exponential backoff between the attempts, when a
+// send fails because the connection to the broker could not be established. The sends that fail for any other reason
+// are not retried, as the broker may have already received the message.
+type reconnectingForwarder struct {
+	Forwarder
+	attempts int
+}
+
+// Sends the body through the wrapped forwarder, reconnecting up to the configured attempts while ctx is not done.
+func (f *reconnectingForwarder) Send(ctx context.Context, topic string, key string, body []byte, headers map[string]string) error {
+	delays := backoff{initial: *reconnectBackoff, max: *reconnectMaxBackoff, jitter: *reconnectJitter}
+	err := f.Forwarder.Send(ctx, topic, key, body, headers)
+	for attempt := 1; attempt <= f.attempts && errors.Is(err, errConnect); attempt++ {
+		log.WithField("topic", topic).Warnf("connection to the broker failed, reconnecting, attempt %d of %d: %v",
+			attempt, f.attempts, err)
+		if !delays.wait(ctx) {
+			return err
+		}
+		err = f.Forwarder.Send(ctx, topic, key, body, headers)
+	}
+	return err
+}
+
+// Forwarder of the dry-run mode, which logs the messages it would send and reports them as sent without connecting to
+// the broker, so that the rest of the pipeline runs as it would but nothing is published.
+type dryRunForwarder struct{}
+
+// Logs the destination, headers and body of the message, without sending it.
+func (dryRunForwarder) Send(_ context.Context, topic string, key string, body []byte, headers map[string]string) error {
+	log.WithFields(logrus.Fields{
+		"topic":   topic,
+		"key":     key,
+		"headers": headers,
+	}).Infof("dry run, not sending the message {topic: %s, message: %s}", topic, body)
+	return nil
+}
+
+// Reports the broker as reachable, as the dry-run mode never connects to it.
+func (dryRunForwarder) Check(context.Context) error {
+	return nil
+}
+
+// Observes the duration of a send to the broker, started at the given time, labeled by its result. The keepalives are
+// left out, so that the probes don't skew the duration of the messages.
+func observeSend(ctx context.Context, start time.Time, err error) {
+	if ctx.Value(keepaliveKey{}) != nil {
+		return
+	}
+	result := "ok"
+	if err != nil {
+		result = "not_ok"
+	}
+	stompSendDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// Returns the names of the headers sorted, so that they are always written in the same order.
+func sortedHeaderNames(headers map[string]string) []string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the error of ctx when it is done, as it is the cause of any error of the operations aborted by closeOnDone.
+// Otherwise, it returns err as it is.
+func contextError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// Closes the closer as soon as ctx is done, aborting whatever is blocked on it. The returned function stops watching
+// ctx and must be called once the closer is no longer in use.
+func closeOnDone(ctx context.Context, closer io.Closer) func() {
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = closer.Close()
+		case <-stop:
+		}
+	}()
+	return func() { close(stop) }
+}
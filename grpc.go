@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"net/http"
+	"time"
+)
+
+// Name of the gRPC service, described in forwarder.proto, through which alerts can be pushed instead of the webhook.
+const grpcServiceName = "alertmanagerstompforwarder.Forwarder"
+
+// Description of the gRPC service. Its only method, Forward, takes a struct with the topic and the alert, with the
+// same fields as the alerts of the webhook, and answers a struct with the number of alerts forwarded and skipped.
+// Using the well known struct type as message lets clients call it from the proto file with no generated code here.
+var grpcServiceDesc = grpc.ServiceDesc{
+	ServiceName: grpcServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Forward", Handler: forwardGRPCHandler},
+	},
+	Metadata: "forwarder.proto",
+}
+
+// Creates the gRPC server exposing the forwarder service and starts serving it on addr, either host:port or
+// unix:///path/to/sock. When credentials are configured, the calls must carry them like the webhooks.
+func serveGRPC(addr string) (*grpc.Server, error) {
+	listener, err := listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	var options []grpc.ServerOption
+	if authEnabled() {
+		options = append(options, grpc.UnaryInterceptor(grpcAuthInterceptor(flagCredentials())))
+	}
+	server := grpc.NewServer(options...)
+	server.RegisterService(&grpcServiceDesc, struct{}{})
+	go func() {
+		log.Infof("listening for grpc on address [%s]", addr)
+		if err := server.Serve(listener); err != nil {
+			log.Fatalf("impossible to serve grpc: %s", err)
+		}
+	}()
+	return server, nil
+}
+
+// Interceptor that fails with UNAUTHENTICATED the calls that do not carry the given bearer token or basic auth
+// credentials in their authorization metadata, checked like the Authorization header of the webhooks.
+func grpcAuthInterceptor(creds credentials) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, request interface{}, _ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		header := http.Header{"Authorization": metadata.ValueFromIncomingContext(ctx, "authorization")}
+		if !creds.authorized(&http.Request{Header: header}) {
+			return nil, status.Error(codes.Unauthenticated, "missing or invalid credentials")
+		}
+		return handler(ctx, request)
+	}
+}
+
+// Returns a function that stops the gRPC server gracefully, waiting for the calls in flight to finish, or stops it
+// right away once ctx is done.
+func shutdownGRPC(server *grpc.Server) func(context.Context) error {
+	return func(ctx context.Context) error {
+		stopped := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			server.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Decodes the request of a call to Forward and serves it through the interceptor, if any.
+func forwardGRPCHandler(srv interface{}, ctx context.Context, decode func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	request := &structpb.Struct{}
+	if err := decode(request); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return forwardGRPC(ctx, request)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + grpcServiceName + "/Forward"}
+	return interceptor(ctx, request, info, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return forwardGRPC(ctx, request.(*structpb.Struct))
+	})
+}
+
+// Forwards the alert of the request to its topic through the same path as the alerts of the webhook. The id of the
+// call is the x-request-id metadata when present or a new random UUID otherwise.
+func forwardGRPC(ctx context.Context, request *structpb.Struct) (*structpb.Struct, error) {
+	id := uuid.NewString()
+	if values := metadata.ValueFromIncomingContext(ctx, "x-request-id"); len(values) > 0 && values[0] != "" {
+		id = values[0]
+	}
+	topic := request.GetFields()["topic"].GetStringValue()
+	logger := log.WithFields(logrus.Fields{
+		"topic":      topic,
+		"request_id": id,
+	})
+
+	alert, err := grpcAlert(request)
+	if err != nil {
+		logger.Errorf("the grpc request is not valid: %s", err)
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	// The call holds a single alert, the group of the webhooks, with no payload version of its own.
+	alerts := Alerts{Alerts: []Alert{alert}, Status: alertStatus(alert, time.Now()), Version: payloadVersion}
+	skipped, _, forward, err := validatePayload(logger, &alerts)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !forward {
+		return structpb.NewStruct(map[string]interface{}{
+			"forwarded":  0,
+			"skipped":    skipped,
+			"request_id": id,
+		})
+	}
+
+	if messagesWAL != nil && messagesWAL.rejecting() {
+		walFull.WithLabelValues("rejected").Inc()
+		logger.Errorf("rejecting the grpc request, the write-ahead log is full")
+		return nil, status.Error(codes.Unavailable, "write-ahead log full")
+	}
+
+	ctx, cancel := forwardContext(ctx)
+	defer cancel()
+	forwarded, alertsSkipped, failed, _, _ := forwardAlerts(ctx, logger, topic, alerts.Alerts, id, map[string]string{
+		"request-id": id,
+	})
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		forwardTimeouts.Inc()
+		logger.Errorf("forwarding the alert timed out after %s", *forwardTimeout)
+		return nil, status.Error(codes.DeadlineExceeded, "forwarding timed out")
+	}
+	if ctx.Err() != nil {
+		logger.Warnf("the grpc request was cancelled before the alert was forwarded")
+		return nil, status.Error(codes.Canceled, "request cancelled")
+	}
+	if failed > 0 {
+		return nil, status.Error(codes.Unavailable, "the alert could not be forwarded")
+	}
+	return structpb.NewStruct(map[string]interface{}{
+		"forwarded":  forwarded,
+		"skipped":    skipped + alertsSkipped,
+		"request_id": id,
+	})
+}
+
+// Returns the alert of a Forward request, checking the request has a topic.
+func grpcAlert(request *structpb.Struct) (Alert, error) {
+	var alert Alert
+	if request.GetFields()["topic"].GetStringValue() == "" {
+		return alert, errors.New("missing topic")
+	}
+	fields := request.GetFields()["alert"].GetStructValue()
+	if fields == nil {
+		return alert, errors.New("missing alert")
+	}
+	data, err := json.Marshal(fields.AsMap())
+	if err != nil {
+		return alert, err
+	}
+	if err := json.Unmarshal(data, &alert); err != nil {
+		return alert, err
+	}
+	normalizeAlert(&alert)
+	return alert, nil
+}
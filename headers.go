@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Returns the headers of the messages of a webhook set from the query parameters of its request: persistent, to make
+// the broker persist the messages, priority, from 0 to 9, ttl, the milliseconds after which the broker expires the
+// messages, and reply-to, the destination the consumers reply to. Out of range priorities and ttls are clamped, while
+// values that are not numbers, booleans or destinations are an error.
+func queryHeaders(query url.Values, now time.Time) (map[string]string, error) {
+	headers := map[string]string{}
+	if value := query.Get("persistent"); value != "" {
+		persistent, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid persistent [%s]", value)
+		}
+		headers["persistent"] = strconv.FormatBool(persistent)
+	}
+	if value := query.Get("priority"); value != "" {
+		priority, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid priority [%s]", value)
+		}
+		if priority < 0 {
+			priority = 0
+		} else if priority > 9 {
+			priority = 9
+		}
+		headers["priority"] = strconv.Itoa(priority)
+	}
+	if value := query.Get("ttl"); value != "" {
+		ttl, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl [%s]", value)
+		}
+		if ttl > 0 {
+			headers["expires"] = strconv.FormatInt(now.Add(time.Duration(ttl)*time.Millisecond).UnixMilli(), 10)
+		}
+	}
+	if value := query.Get("reply-to"); value != "" {
+		if !validDestination(value) {
+			return nil, fmt.Errorf("invalid reply-to [%s]", value)
+		}
+		headers["reply-to"] = value
+	}
+	return headers, nil
+}
+
+// Returns whether the name can be used as a destination of the broker: it's not empty and has no spaces nor control
+// characters.
+func validDestination(name string) bool {
+	return name != "" && strings.IndexFunc(name, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}) < 0
+}
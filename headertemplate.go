@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"text/template"
+)
+
+// A header set on the message of each alert, its value rendered from a template executed with the alert.
+type headerTemplate struct {
+	name     string
+	template *template.Template
+}
+
+// The templated headers, parsed from the header-template flags, in the order they were given.
+var headerTemplates []headerTemplate
+
+// Parses the templated headers, each given as name=template, like team={{ .Labels.team }}.
+func parseHeaderTemplates(values []string) ([]headerTemplate, error) {
+	var templates []headerTemplate
+	for _, value := range values {
+		name, text, ok := strings.Cut(value, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("header template [%s] is not name=template", value)
+		}
+		tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("header template [%s]: %w", name, err)
+		}
+		templates = append(templates, headerTemplate{name: name, template: tmpl})
+	}
+	return templates, nil
+}
+
+// Sets the templated headers rendered for the alert in headers. The headers whose template renders empty are left
+// out, as are the ones whose template fails, which is logged as a warning with the fields of the given logger, so a
+// failing template never fails the send. Under strictTemplates the failure is returned instead.
+func addTemplatedHeaders(logger *logrus.Entry, headers map[string]string, alert Alert) error {
+	for _, header := range headerTemplates {
+		value, err := executeAlertTemplate(header.template, alert)
+		if err != nil {
+			if strictTemplates {
+				return fmt.Errorf("header template [%s] failed: %w", header.name, err)
+			}
+			logger.WithField("header", header.name).Warnf("the header template failed, leaving the header out: %s", err)
+			continue
+		}
+		if value != "" {
+			headers[header.name] = value
+		}
+	}
+	return nil
+}
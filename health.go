@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// Whether the last connection attempt to the broker succeeded. It backs the readiness probe.
+	brokerHealthy atomic.Bool
+
+	stompConnectionHealthy = metricsFactory.NewGauge(prometheus.GaugeOpts{
+		Name: "stomp_connection_healthy",
+		Help: "Whether the last connection attempt to the broker succeeded (1) or not (0).",
+	})
+
+	stompLastHealthCheck = metricsFactory.NewGauge(prometheus.GaugeOpts{
+		Name: "stomp_last_health_check_timestamp_seconds",
+		Help: "Unix timestamp of the last connectivity check against the broker.",
+	})
+)
+
+// Records the health of the broker both for the readiness probe and the metrics.
+func setBrokerHealthy(healthy bool) {
+	brokerHealthy.Store(healthy)
+	if healthy {
+		stompConnectionHealthy.Set(1)
+	} else {
+		stompConnectionHealthy.Set(0)
+	}
+}
+
+// Verifies through the forwarder that the broker is reachable and accepts the configured credentials, recording the
+// outcome as the broker health.
+func checkBroker() {
+	defer stompLastHealthCheck.SetToCurrentTime()
+	ctx, cancel := forwardContext(context.Background())
+	defer cancel()
+	err := forwarder.Check(ctx)
+	setBrokerHealthy(err == nil)
+	if err != nil {
+		log.Warnf("the %s broker is not reachable: %s", *backend, err)
+	}
+}
+
+// Checks the broker right away so that the readiness is known before the first alert arrives, and then every
+// interval. When the interval is zero only the first check is done.
+func runBrokerHealthChecks(interval time.Duration) {
+	checkBroker()
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		checkBroker()
+	}
+}
+
+// Checks the broker until it is reachable, retrying up to the given times with the reconnection backoff between the
+// attempts, each of them aborted after the timeout. It lets the forwarder wait at startup for a broker that is still
+// booting, as in a fresh deploy, instead of crash-looping. Returns the error of the last attempt when none succeeded.
+func waitForBroker(retries int, timeout time.Duration) error {
+	delays := backoff{initial: *reconnectBackoff, max: *reconnectMaxBackoff, jitter: *reconnectJitter}
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := forwarder.Check(ctx)
+		cancel()
+		setBrokerHealthy(err == nil)
+		if err == nil {
+			log.Infof("connected to the %s broker, attempt %d of %d", *backend, attempt, retries+1)
+			return nil
+		}
+		if attempt > retries {
+			return fmt.Errorf("broker not reachable after %d attempts: %w", attempt, err)
+		}
+		log.Warnf("the %s broker is not reachable, attempt %d of %d: %s", *backend, attempt, retries+1, err)
+		delays.wait(context.Background())
+	}
+}
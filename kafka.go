@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"net"
+	"time"
+)
+
+// Forwarder that produces the messages to a Kafka cluster. The topic of the webhook is the Kafka topic and the key of
+// the message, the fingerprint of the alert, picks its partition. Unlike the other backends, the connections to the
+// brokers are kept open and shared by all the messages.
+type kafkaForwarder struct {
+	writer *kafka.Writer
+	client *kafka.Client
+}
+
+// Creates a forwarder that produces to the Kafka cluster reachable through the given brokers. When saslMechanism is
+// not none the connections are authenticated with the given credentials, and when useTLS is set they are encrypted.
+func newKafkaForwarder(brokers []string, saslMechanism, saslUser, saslPass string, useTLS bool) (*kafkaForwarder, error) {
+	mechanism, err := newKafkaSASLMechanism(saslMechanism, saslUser, saslPass)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &kafka.Transport{SASL: mechanism}
+	if useTLS {
+		transport.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	addr := kafka.TCP(brokers...)
+	return &kafkaForwarder{
+		writer: &kafka.Writer{
+			Addr:         addr,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			BatchTimeout: 10 * time.Millisecond,
+			Transport:    transport,
+		},
+		client: &kafka.Client{
+			Addr:      addr,
+			Timeout:   10 * time.Second,
+			Transport: transport,
+		},
+	}, nil
+}
+
+// Returns the SASL mechanism with the given name, nil when it is none.
+func newKafkaSASLMechanism(name, user, pass string) (sasl.Mechanism, error) {
+	switch name {
+	case "none":
+		return nil, nil
+	case "plain":
+		return plain.Mechanism{Username: user, Password: pass}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, user, pass)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, user, pass)
+	}
+	return nil, fmt.Errorf("unknown sasl mechanism [%s]", name)
+}
+
+// Produces the body to the topic with the given key, waiting for all the in-sync replicas to acknowledge it. The
+// headers are added as the headers of the record.
+func (f *kafkaForwarder) Send(ctx context.Context, topic string, key string, body []byte, headers map[string]string) error {
+	message := kafka.Message{
+		Topic: topic,
+		Key:   []byte(key),
+		Value: body,
+	}
+	for _, name := range sortedHeaderNames(headers) {
+		message.Headers = append(message.Headers, kafka.Header{Key: name, Value: []byte(headers[name])})
+	}
+
+	sendStart := time.Now()
+	err := f.writer.WriteMessages(ctx, message)
+	observeSend(ctx, sendStart, err)
+	var dialErr *net.OpError
+	if errors.As(err, &dialErr) && dialErr.Op == "dial" {
+		return fmt.Errorf("%w: %w", errConnect, err)
+	}
+	return err
+}
+
+// Requests the metadata of the cluster, which verifies the brokers are reachable and accept the credentials.
+func (f *kafkaForwarder) Check(ctx context.Context) error {
+	_, err := f.client.Metadata(ctx, &kafka.MetadataRequest{})
+	if err != nil {
+		return fmt.Errorf("%w: %w", errConnect, err)
+	}
+	return nil
+}
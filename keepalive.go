@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// The body of the keepalive messages, a tiny json object the consumers of the keepalive topic can tell apart from an
+// alert.
+var keepaliveMessage = []byte(`{"keepalive":true}`)
+
+var keepalives = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+	Name: "keepalives_total",
+	Help: "Total number of keepalive messages sent to the broker",
+}, []string{"result"})
+
+// Key of the context value marking the sends of the keepalives.
+type keepaliveKey struct{}
+
+// Returns a context under which the sends are keepalives, left out of the duration of the sends to the broker.
+func asKeepalive(ctx context.Context) context.Context {
+	return context.WithValue(ctx, keepaliveKey{}, true)
+}
+
+// Sends a keepalive message to the topic, through the forwarder of the topic, recording the outcome as the broker
+// health when it's the one of the configured backend. It goes straight through the forwarder, so it's only counted in
+// the keepalive metric and not in the ones of the alerts.
+func sendKeepalive(topic string) {
+	ctx, cancel := forwardContext(asKeepalive(withoutWAL(context.Background())))
+	defer cancel()
+	keepaliveForwarder, configured := topicForwarder(ctx, topic)
+	err := keepaliveForwarder.Send(ctx, topic, "", keepaliveMessage, map[string]string{
+		"content-type": "application/json",
+		"keepalive":    "true",
+	})
+	if configured {
+		setBrokerHealthy(err == nil)
+	}
+	if err != nil {
+		keepalives.WithLabelValues("not_ok").Inc()
+		log.WithField("topic", topic).Warnf("the keepalive could not be sent to the %s broker: %s", *backend, err)
+		return
+	}
+	keepalives.WithLabelValues("ok").Inc()
+	log.WithField("topic", topic).Debugf("keepalive sent to the broker")
+}
+
+// Sends a keepalive message to the topic every interval, so that a broken path to the broker, or a destination the
+// broker refuses, is noticed before the next alert. Every keepalive is sent on a new connection, like the alerts, so
+// it's a periodic end-to-end probe and doesn't keep any connection open.
+func runKeepalives(interval time.Duration, topic string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		sendKeepalive(topic)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+)
+
+// Prefix of the listen addresses that refer to a unix domain socket.
+const unixAddrPrefix = "unix://"
+
+// Listens on the given address, which is either a host:port TCP address or a unix:///path/to/sock unix domain socket.
+// A stale socket file left behind by a previous run is removed first. The socket file is removed again once the
+// listener is closed.
+func listen(addr string) (net.Listener, error) {
+	path, isUnix := strings.CutPrefix(addr, unixAddrPrefix)
+	if !isUnix {
+		return net.Listen("tcp", addr)
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v2"
+	"net/http"
+	"os"
+)
+
+// Key of the gin context under which the default topic of the listener serving the request is stored.
+const defaultTopicKey = "default_topic"
+
+// The config of an additional listener, serving the webhooks on an address of its own, with its own credentials,
+// default topic and stomp server.
+type listenerConfig struct {
+	Addr         string `yaml:"addr"`
+	AuthToken    string `yaml:"auth_token"`
+	AuthUser     string `yaml:"auth_user"`
+	AuthPass     string `yaml:"auth_pass"`
+	DefaultTopic string `yaml:"default_topic"`
+	StompAddr    string `yaml:"stomp_addr"`
+	StompUser    string `yaml:"stomp_user"`
+	StompPass    string `yaml:"stomp_pass"`
+}
+
+// The file holding the configs of the additional listeners.
+type listenersConfig struct {
+	Listeners []listenerConfig `yaml:"listeners"`
+}
+
+// Key of the context value holding the forwarder of the listener serving the request.
+type forwarderKey struct{}
+
+// Loads the configs of the additional listeners from the yaml file at path. Every listener must have an address of its
+// own, the stomp server of a listener can only be set with the stomp backend, without a write-ahead log, and its stomp
+// credentials only along with it.
+func loadListeners(path string) ([]listenerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file listenersConfig
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, err
+	}
+
+	addrs := map[string]bool{*listenAddr: true, *adminAddr: true, *grpcAddr: true}
+	for i, config := range file.Listeners {
+		if config.Addr == "" {
+			return nil, fmt.Errorf("listener %d has no addr", i+1)
+		}
+		if addrs[config.Addr] {
+			return nil, fmt.Errorf("listener %d addr [%s] is already used", i+1, config.Addr)
+		}
+		addrs[config.Addr] = true
+		if config.StompAddr != "" && *backend != "stomp" {
+			return nil, fmt.Errorf("listener %d sets a stomp_addr with the %s backend", i+1, *backend)
+		}
+		if config.StompAddr != "" && *walDir != "" {
+			return nil, fmt.Errorf("listener %d sets a stomp_addr, whose messages can't go through the write-ahead log "+
+				"of --wal-dir", i+1)
+		}
+		if config.StompAddr == "" && (config.StompUser != "" || config.StompPass != "") {
+			return nil, fmt.Errorf("listener %d sets stomp credentials without a stomp_addr", i+1)
+		}
+	}
+	return file.Listeners, nil
+}
+
+// Returns a context under which the sends go through the given forwarder instead of the one of the configured backend.
+func withForwarder(ctx context.Context, forwarder Forwarder) context.Context {
+	return context.WithValue(ctx, forwarderKey{}, forwarder)
+}
+
+// Returns the forwarder the sends under ctx go through, the one of the listener serving the request, if it has one, or
+// the one of the configured backend otherwise, and whether it's the latter.
+func forwarderOf(ctx context.Context) (Forwarder, bool) {
+	if listenerForwarder, ok := ctx.Value(forwarderKey{}).(Forwarder); ok {
+		return listenerForwarder, false
+	}
+	return forwarder, true
+}
+
+// Creates the forwarder of a listener publishing to its own stomp server, with the credentials of the flags when it
+// sets none, as the topics do, and the rest of the stomp options of the flags, or returns nil when the listener uses
+// the one of the configured backend.
+func newListenerForwarder(config listenerConfig) Forwarder {
+	if config.StompAddr == "" {
+		return nil
+	}
+	connection := stompConnection(config.StompAddr, config.StompUser, config.StompPass)
+	return newStompForwarderTo(connection[0], connection[1], connection[2])
+}
+
+// Returns a middleware that makes the requests of a listener go through its forwarder, if any, and fall back to its
+// default topic when they post to no topic.
+func listenerMiddleware(config listenerConfig, listenerForwarder Forwarder) gin.HandlerFunc {
+	return func(requestContext *gin.Context) {
+		if listenerForwarder != nil {
+			requestContext.Request = requestContext.Request.WithContext(
+				withForwarder(requestContext.Request.Context(), listenerForwarder))
+		}
+		requestContext.Set(defaultTopicKey, config.DefaultTopic)
+		requestContext.Next()
+	}
+}
+
+// Returns the router of an additional listener, serving only the webhooks, protected by the credentials of the
+// listener.
+func createListenerRouter(config listenerConfig) *gin.Engine {
+	router := newRouter()
+	if len(corsAllowedOrigins) > 0 {
+		router.Use(corsMiddleware(corsAllowedOrigins))
+	}
+	router.Use(listenerMiddleware(config, newListenerForwarder(config)))
+	creds := credentials{token: config.AuthToken, user: config.AuthUser, pass: config.AuthPass}
+	routes := router.Group(basePath)
+	registerWebhookRoute(routes, "/alerts/*topic", creds, alertPOSTHandler)
+	registerWebhookRoute(routes, "/test/*topic", creds, testPOSTHandler)
+	return router
+}
+
+// Starts serving the webhooks of an additional listener on its address. Returns its server so that it's shut down
+// along with the rest.
+func serveListener(config listenerConfig) (*http.Server, error) {
+	listener, err := listen(config.Addr)
+	if err != nil {
+		return nil, err
+	}
+	server := newHTTPServer(createListenerRouter(config))
+	go func() {
+		log.Infof("listening for the webhooks of the listener on address [%s]", config.Addr)
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("impossible to serve the listener on address [%s]: %s", config.Addr, err)
+		}
+	}()
+	return server, nil
+}
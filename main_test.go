@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/go-stomp/stomp/frame"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Parses the default values of the flags, which the code under test reads, registers the metrics main sets up from
+// them and silences the logs.
+func TestMain(m *testing.M) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		panic(err)
+	}
+	registerHTTPDuration(prometheus.DefBuckets)
+	gin.SetMode(gin.TestMode)
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestUnmarshalAlertsNullLabels(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "webhook", body: `{"version":"4","alerts":[{"status":"firing","labels":null,"annotations":null}]}`},
+		{name: "raw array", body: `[{"status":"firing","labels":null,"annotations":null}]`},
+		{name: "missing", body: `{"version":"4","alerts":[{"status":"firing"}]}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			alerts, err := unmarshalAlerts(strings.NewReader(test.body), "")
+			if err != nil {
+				t.Fatalf("unmarshalAlerts: %s", err)
+			}
+			if len(alerts.Alerts) != 1 {
+				t.Fatalf("got %d alerts, want 1", len(alerts.Alerts))
+			}
+			alert := alerts.Alerts[0]
+			if alert.Labels == nil || len(alert.Labels) != 0 {
+				t.Errorf("labels = %#v, want an empty map", alert.Labels)
+			}
+			if alert.Annotations == nil || len(alert.Annotations) != 0 {
+				t.Errorf("annotations = %#v, want an empty map", alert.Annotations)
+			}
+			message, err := json.Marshal(alert)
+			if err != nil {
+				t.Fatalf("marshalling the alert: %s", err)
+			}
+			if !strings.Contains(string(message), `"labels":{}`) {
+				t.Errorf("message %s doesn't hold empty labels", message)
+			}
+		})
+	}
+}
+
+func TestUnmarshalAlertsBareArrayVersion(t *testing.T) {
+	previous := *strictPayloadVersion
+	*strictPayloadVersion = true
+	defer func() { *strictPayloadVersion = previous }()
+	alerts, err := unmarshalAlerts(strings.NewReader(`[{"labels":{"alertname":"X"}}]`), "raw-array")
+	if err != nil {
+		t.Fatalf("unmarshalAlerts: %s", err)
+	}
+	if alerts.Version != payloadVersion {
+		t.Errorf("version = %q, want %q", alerts.Version, payloadVersion)
+	}
+	if _, _, forward, err := validatePayload(log.WithField("topic", "alerts"), &alerts); err != nil || !forward {
+		t.Errorf("validatePayload with a strict payload version = %t, %v, want the alerts forwarded", forward, err)
+	}
+}
+
+func TestGroupKeyHeader(t *testing.T) {
+	broker := newFakeBroker(t)
+	previousForwarder := forwarder
+	forwarder = newStompForwarder(broker.addr(), "", "", "", "", "tcp", "auto", 0, 0, false, "")
+	defer func() { forwarder = previousForwarder }()
+
+	// The group keys of the routes with matchers hold colons and quoted values, which the stomp headers escape.
+	groupKey := `{}/{severity="critical"}:{alertname="High:Latency", instance="api-1"}`
+	payload, err := json.Marshal(Alerts{
+		GroupKey: groupKey,
+		Status:   "firing",
+		Version:  payloadVersion,
+		Alerts:   []Alert{{Labels: map[string]string{"alertname": "High:Latency"}}},
+	})
+	if err != nil {
+		t.Fatalf("marshalling the payload: %s", err)
+	}
+	request := httptest.NewRequest(http.MethodPost, "/alerts/alerts", bytes.NewReader(payload))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	createConfiguredRouter().ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+	}
+
+	sends := broker.received(frame.SEND)
+	if len(sends) != 1 {
+		t.Fatalf("got %d SEND frames, want 1", len(sends))
+	}
+	if got := sends[0].Header.Get("group-key"); got != groupKey {
+		t.Errorf("group-key header = %q, want %q", got, groupKey)
+	}
+}
+
+func TestTestAlertReceipt(t *testing.T) {
+	tests := []struct {
+		name         string
+		writeTimeout time.Duration
+		want         bool
+	}{
+		{name: "requested", writeTimeout: 5 * time.Second, want: true},
+		{name: "not requested", writeTimeout: 0, want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker := newFakeBroker(t)
+			previousForwarder := forwarder
+			forwarder = newStompForwarder(broker.addr(), "", "", "", "", "tcp", "auto", test.writeTimeout, 0, false,
+				"")
+			defer func() { forwarder = previousForwarder }()
+
+			request := httptest.NewRequest(http.MethodPost, "/test/alerts", nil)
+			request.Header.Set(requestIDHeader, "test-request")
+			recorder := httptest.NewRecorder()
+			createConfiguredRouter().ServeHTTP(recorder, request)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+			}
+			var response struct {
+				Sent      bool   `json:"sent"`
+				Receipt   bool   `json:"receipt"`
+				RequestID string `json:"request_id"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatalf("the response is not json: %s", err)
+			}
+			if !response.Sent || response.Receipt != test.want {
+				t.Errorf("sent = %t, receipt = %t, want sent and receipt %t", response.Sent, response.Receipt, test.want)
+			}
+			if response.RequestID != "test-request" {
+				t.Errorf("request_id = %q, want the X-Request-ID of the request", response.RequestID)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// Buffer and json encoder writing into it, reused across the marshalling of the alerts.
+type messageEncoder struct {
+	buffer  bytes.Buffer
+	encoder *json.Encoder
+}
+
+// The annotations lifted to top-level fields of the forwarded json, parsed from the flatten-annotation-keys flag.
+var flattenedAnnotationKeys []string
+
+// The fields of the forwarded json kept by the projection, parsed from the message-fields flag. All of them are kept
+// when empty.
+var projectedFields []string
+
+// The names of the fields of the forwarded alerts, which the flattened annotations can't take.
+var alertFields = map[string]bool{
+	"annotations":  true,
+	"endsAt":       true,
+	"fingerprint":  true,
+	"generatorURL": true,
+	"labels":       true,
+	"startsAt":     true,
+	"status":       true,
+	"topic":        true,
+}
+
+// Pool of the encoders used to marshal the alerts, so that forwarding does not allocate a new buffer for each alert.
+var messageEncoders = sync.Pool{
+	New: func() interface{} {
+		encoder := &messageEncoder{}
+		encoder.encoder = json.NewEncoder(&encoder.buffer)
+		if *jsonPretty {
+			encoder.encoder.SetIndent("", "  ")
+		}
+		return encoder
+	},
+}
+
+// Marshals the alert as json with an encoder taken from the pool, compact or indented if the json-pretty flag is set.
+// The keys are always in the same order: the fields of the alert are in the order of the struct and the labels and
+// annotations sorted by name, so the same alert is always marshalled to the same bytes. The returned function gives
+// the encoder back to the pool; the message is backed by its buffer, so it must not be used after calling it. With the
+// flatten-annotations flag set, the flattened annotations are top-level fields and the keys are all sorted by name, as
+// they are when the message-fields flag projects the fields of the json.
+func marshalAlert(alert Alert) ([]byte, func(), error) {
+	encoder := messageEncoders.Get().(*messageEncoder)
+	encoder.buffer.Reset()
+	release := func() { messageEncoders.Put(encoder) }
+
+	var message interface{} = alert
+	if *flattenAnnotations {
+		message = flattenAlert(alert, flattenedAnnotationKeys)
+	}
+	if len(projectedFields) > 0 {
+		projected, err := projectMessage(message, projectedFields)
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		message = projected
+	}
+	if err := encoder.encoder.Encode(message); err != nil {
+		release()
+		return nil, nil, err
+	}
+	// Unlike json.Marshal, the encoder terminates each value with a newline.
+	return bytes.TrimSuffix(encoder.buffer.Bytes(), []byte("\n")), release, nil
+}
+
+// Returns the fields of the alert with the given annotations lifted from the annotations to top-level fields, so that
+// the consumers find them without going through the nested annotations. The rest of the annotations stay nested, as
+// do the ones named after a field of the alert, which they can't replace.
+func flattenAlert(alert Alert, keys []string) map[string]interface{} {
+	message := map[string]interface{}{
+		"endsAt":       alert.EndsAt,
+		"generatorURL": alert.GeneratorURL,
+		"labels":       alert.Labels,
+		"startsAt":     alert.StartsAt,
+	}
+	if alert.Fingerprint != "" {
+		message["fingerprint"] = alert.Fingerprint
+	}
+	if alert.Status != "" {
+		message["status"] = alert.Status
+	}
+	if alert.Topic != "" {
+		message["topic"] = alert.Topic
+	}
+
+	var annotations map[string]interface{}
+	if alert.Annotations != nil {
+		annotations = make(map[string]interface{}, len(alert.Annotations))
+		for name, value := range alert.Annotations {
+			annotations[name] = value
+		}
+	}
+	for _, key := range keys {
+		value, ok := annotations[key]
+		if !ok || alertFields[key] {
+			continue
+		}
+		message[key] = value
+		delete(annotations, key)
+	}
+	message["annotations"] = annotations
+	return message
+}
+
+// Returns the json object the message is marshalled to with only the given fields, either top-level fields, like
+// startsAt, or fields of a nested object, like labels.alertname. The fields missing from the message are left out.
+func projectMessage(message interface{}, fields []string) (map[string]interface{}, error) {
+	marshalled, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(marshalled, &object); err != nil {
+		return nil, err
+	}
+
+	projected := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		name, key, nested := strings.Cut(field, ".")
+		value, ok := object[name]
+		if !ok {
+			continue
+		}
+		if !nested {
+			projected[name] = value
+			continue
+		}
+		nestedObject, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		nestedValue, ok := nestedObject[key]
+		if !ok {
+			continue
+		}
+		target, ok := projected[name].(map[string]interface{})
+		if !ok {
+			target = map[string]interface{}{}
+			projected[name] = target
+		}
+		target[key] = nestedValue
+	}
+	return projected, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+// Forwarder that discards the messages, so the benchmarks only measure the forwarder itself.
+type discardForwarder struct{}
+
+func (discardForwarder) Send(context.Context, string, string, []byte, map[string]string) error {
+	return nil
+}
+
+func (discardForwarder) Check(context.Context) error { return nil }
+
+var benchmarkAlert = Alert{
+	Annotations: map[string]interface{}{
+		"summary":     "The latency of the api is above 500ms",
+		"description": "The p99 latency of the api has been above 500ms for the last 10 minutes",
+	},
+	Labels: map[string]string{
+		"alertname": "HighLatency",
+		"instance":  "api-1:8080",
+		"job":       "api",
+		"severity":  "critical",
+	},
+	StartsAt:     "2023-06-01T10:00:00Z",
+	GeneratorURL: "http://prometheus:9090/graph?g0.expr=latency",
+}
+
+func BenchmarkSendAlert(b *testing.B) {
+	previous := forwarder
+	forwarder = discardForwarder{}
+	defer func() { forwarder = previous }()
+	logger := log.WithField("topic", "alerts")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := sendAlertToStomp(context.Background(), logger, "alerts", benchmarkAlert, "id",
+			map[string]string{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Compares the marshalling of the alerts with the pooled encoders to json.Marshal, allocating a buffer for each.
+func BenchmarkMarshalAlert(b *testing.B) {
+	b.Run("pool", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, release, err := marshalAlert(benchmarkAlert)
+			if err != nil {
+				b.Fatal(err)
+			}
+			release()
+		}
+	})
+	b.Run("json.Marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := json.Marshal(benchmarkAlert); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"regexp"
+	"sync"
+)
+
+var (
+	// The registry all the metrics of the application are registered against, and served from, instead of the global
+	// default one. Besides the metrics of the application it holds the process metrics, like open file descriptors
+	// and memory, and the Go runtime metrics, like goroutines, heap and GC.
+	metricsRegistry = newMetricsRegistry()
+
+	// Registerer of the metrics of the application. The metrics are defined as package variables, before the flags are
+	// parsed, so their registration is deferred until the namespace is known.
+	metricsRegisterer = &deferredRegisterer{}
+
+	// Factory registering the metrics it creates against the registry of the application.
+	metricsFactory = promauto.With(metricsRegisterer)
+
+	// Valid metric namespaces, the same characters as the metric names without the colons.
+	metricsNamespacePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Creates the registry of the application with the process and Go runtime collectors already registered.
+func newMetricsRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewGoCollector(
+			collectors.WithGoCollectorRuntimeMetrics(collectors.MetricsGC, collectors.MetricsScheduler),
+		),
+	)
+	return registry
+}
+
+// Registerer that holds the metrics registered against it until registerMetrics is called, and registers them right
+// away afterwards.
+type deferredRegisterer struct {
+	mu         sync.Mutex
+	pending    []prometheus.Collector
+	registerer prometheus.Registerer
+}
+
+// Registers the collector, or holds it until the metrics are registered.
+func (r *deferredRegisterer) Register(collector prometheus.Collector) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.registerer == nil {
+		r.pending = append(r.pending, collector)
+		return nil
+	}
+	return r.registerer.Register(collector)
+}
+
+// Registers the collectors, panicking if any of them can't be registered.
+func (r *deferredRegisterer) MustRegister(collectors ...prometheus.Collector) {
+	for _, collector := range collectors {
+		if err := r.Register(collector); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Unregisters the collector, or stops holding it.
+func (r *deferredRegisterer) Unregister(collector prometheus.Collector) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.registerer == nil {
+		for i, pending := range r.pending {
+			if pending == collector {
+				r.pending = append(r.pending[:i], r.pending[i+1:]...)
+				return true
+			}
+		}
+		return false
+	}
+	return r.registerer.Unregister(collector)
+}
+
+// Registers the metrics of the application against its registry, their names prefixed by the namespace and an
+// underscore, or as they are when it's empty. The process and Go runtime metrics are left unprefixed, like in any
+// other application. It must be called once, after parsing the flags; the metrics defined afterwards are registered
+// right away with the same namespace.
+func registerMetrics(namespace string) {
+	var registerer prometheus.Registerer = metricsRegistry
+	if namespace != "" {
+		registerer = prometheus.WrapRegistererWithPrefix(namespace+"_", metricsRegistry)
+	}
+
+	metricsRegisterer.mu.Lock()
+	defer metricsRegisterer.mu.Unlock()
+	metricsRegisterer.registerer = registerer
+	registerer.MustRegister(metricsRegisterer.pending...)
+	metricsRegisterer.pending = nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// Returns a handler serving the net/http/pprof endpoints under /debug/pprof/.
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// Serves the profiling endpoints on their own address, so they are not reachable through the webhook port.
+func servePprof(addr string) {
+	log.Infof("serving pprof on address [%s]", addr)
+	err := http.ListenAndServe(addr, pprofHandler())
+	if err != nil {
+		log.Errorf("impossible to serve pprof: %s", err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+)
+
+// The topics whose webhooks are forwarded raw, parsed from the forward-raw-topics flag.
+var rawTopics map[string]bool
+
+// Returns whether the webhooks posted to the topic are forwarded raw, either because all of them are or because the
+// topic is one of the raw topics.
+func forwardsRaw(topic string) bool {
+	return *forwardRaw || rawTopics[topic]
+}
+
+// Reads the alerts of a webhook from its body, like unmarshalAlerts, returning along with them the body as it was
+// received when raw is set, nil otherwise.
+func readAlerts(body io.Reader, schema string, raw bool) (Alerts, []byte, error) {
+	if !raw {
+		alerts, err := unmarshalAlerts(body, schema)
+		return alerts, nil, err
+	}
+	rawBody, err := io.ReadAll(body)
+	if err != nil {
+		return Alerts{}, nil, err
+	}
+	alerts, err := unmarshalAlerts(bytes.NewReader(rawBody), schema)
+	return alerts, rawBody, err
+}
+
+// Forwards the body of a webhook as it was received, in a single message, to the destinations of the topic, with the
+// given content type, or the configured one when empty. The alerts it holds are only used for the metrics and the
+// dispositions: none of them is skipped, as the body is sent whole. Returns the number of alerts forwarded and that
+// failed to be forwarded, along with the disposition of each alert under debug mode and the error of the send, if any.
+func forwardRawBody(ctx context.Context, logger *logrus.Entry, topic string, body []byte, contentType string,
+	alerts []Alert, correlationID string, headers map[string]string) (forwarded int, failed int,
+	dispositions alertDispositions, err error) {
+	if contentType == "" {
+		contentType = *stompContentType
+	}
+	logger = logger.WithField("correlation_id", correlationID)
+	err = forwardToDestinations(logger, alertDestinations(topic), func(destination string) error {
+		return sendRawToStomp(ctx, logger, destination, body, contentType, alerts, correlationID, headers)
+	})
+	if err != nil {
+		dispositions.addAll(alerts, actionFailed, err.Error())
+		return 0, len(alerts), dispositions, err
+	}
+	dispositions.addAll(alerts, actionForwarded, "")
+	for _, alert := range alerts {
+		recordForwarded(alert)
+	}
+	return len(alerts), 0, dispositions, nil
+}
+
+// Sends the body of a webhook to the topic as it is. The message carries the correlation id of the webhook and its
+// group key as key, along with the given headers, like the batches do.
+func sendRawToStomp(ctx context.Context, logger *logrus.Entry, topic string, body []byte, contentType string,
+	alerts []Alert, correlationID string, headers map[string]string) (err error) {
+	ctx, span := tracer.Start(ctx, "send raw body", trace.WithAttributes(
+		attribute.String("topic", topic),
+		attribute.Int("alert.count", len(alerts)),
+	))
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	logger = logger.WithField("topic", topic)
+	logger.Infof("forwarding the raw body of %d alerts to the broker", len(alerts))
+	messageHeaders := map[string]string{
+		"content-type":   contentType,
+		"correlation-id": correlationID,
+	}
+	if *enableBrokerDedup {
+		keys := make([]string, len(alerts))
+		for i, alert := range alerts {
+			keys[i] = idempotencyKey(alert, fingerprint(alert.Labels))
+		}
+		messageHeaders[*dedupHeader] = batchIdempotencyKey(keys)
+	}
+	return sendMessage(ctx, logger, topic, headers["group-key"], body, messageHeaders, headers)
+}
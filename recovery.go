@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	runtimedebug "runtime/debug"
+)
+
+var panicsRecovered = metricsFactory.NewCounter(prometheus.CounterOpts{
+	Name: "panics_recovered_total",
+	Help: "Total number of panics recovered while serving a request",
+})
+
+// Returns a middleware that recovers from the panics of the handlers, logging them along with their stack through the
+// logger of the application and counting them, so that they show up in the dashboards. The request is answered with a
+// 500 and a json body holding the request id, like any other failed request.
+func recoveryMiddleware() gin.HandlerFunc {
+	return func(requestContext *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			panicsRecovered.Inc()
+			log.WithFields(logrus.Fields{
+				"method":     requestContext.Request.Method,
+				"path":       requestContext.Request.URL.Path,
+				"request_id": requestID(requestContext),
+				"stack":      string(runtimedebug.Stack()),
+			}).Errorf("recovered from a panic: %v", recovered)
+			requestContext.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":      "internal error",
+				"request_id": requestID(requestContext),
+			})
+		}()
+		requestContext.Next()
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	serveCommand  = kingpin.Command("serve", "Serve the webhook, forwarding the alerts to the broker").Default()
+	renderCommand = kingpin.Command("render", "Print the messages an Alertmanager payload is forwarded as, without connecting to the broker")
+	renderTopic   = renderCommand.Arg("topic", "Topic the payload is posted to, as in /alerts/<topic>, its segments joined with the topic separator").Required().String()
+	renderFile    = renderCommand.Flag("file", "File holding the payload, the standard input when -").Short('f').Default("-").String()
+)
+
+// Forwarder of the render command, which writes the messages it is given to out, instead of sending them, as the
+// destination and headers of the frame followed by its body.
+type renderForwarder struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// Writes the destination, headers and body of the message to the output, sorting the headers by name.
+func (f *renderForwarder) Send(_ context.Context, topic string, _ string, body []byte, headers map[string]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := fmt.Fprintf(f.out, "destination:%s\n", topic); err != nil {
+		return err
+	}
+	for _, name := range sortedHeaderNames(headers) {
+		if _, err := fmt.Fprintf(f.out, "%s:%s\n", name, headers[name]); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(f.out, "\n%s\n\n", body)
+	return err
+}
+
+// Reports the broker as reachable, as rendering never connects to it.
+func (*renderForwarder) Check(context.Context) error {
+	return nil
+}
+
+// Reads the payload of a webhook from the file at path, or from the standard input when it's -, and writes to out the
+// messages it is forwarded as when posted to the topic, going through the same validations, filters and formatting
+// of the configured flags and topics file as the webhooks do, only without the dedup. Returns an error when the payload
+// would be rejected or any of its messages can't be built, like with fields the projection can't take or a failing
+// topic or header template.
+func runRender(path string, topic string, out io.Writer) error {
+	input := io.Reader(os.Stdin)
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = file.Close() }()
+		input = file
+	}
+
+	topic = strings.ReplaceAll(strings.Trim(topic, "/"), "/", *topicSeparator)
+	alerts, rawBody, err := readAlerts(input, *payloadSchema, forwardsRaw(topic))
+	if err != nil {
+		return fmt.Errorf("invalid json: %w", err)
+	}
+	correlationID := uuid.NewString()
+	logger := log.WithFields(logrus.Fields{"topic": topic, "request_id": correlationID, "status": alerts.Status})
+	if _, _, forward, err := validatePayload(logger, &alerts); err != nil || !forward {
+		return err
+	}
+
+	headers := map[string]string{"request-id": correlationID}
+	if alerts.GroupKey != "" {
+		headers["group-key"] = alerts.GroupKey
+	}
+	if *addContextHeaders {
+		if alerts.Receiver != "" {
+			headers["receiver"] = alerts.Receiver
+		}
+		if alerts.ExternalURL != "" {
+			headers["external-url"] = alerts.ExternalURL
+		}
+	}
+
+	// The topics with a stomp server of their own are rendered as well, and a failing template fails the command.
+	forwarder = &renderForwarder{out: out}
+	for name, override := range topicOverrides {
+		override.forwarder = nil
+		topicOverrides[name] = override
+	}
+	strictTemplates = true
+	var failed int
+	if rawBody != nil {
+		_, failed, _, err = forwardRawBody(context.Background(), logger, topic, rawBody, "", alerts.Alerts, correlationID,
+			headers)
+	} else {
+		_, _, failed, _, err = forwardAlerts(context.Background(), logger, topic, alerts.Alerts, correlationID, headers)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d alerts could not be rendered: %w", failed, len(alerts.Alerts), err)
+	}
+	return nil
+}
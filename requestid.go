@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+// Header carrying the id of a request, both in the request and in its response.
+const requestIDHeader = "X-Request-ID"
+
+// Key of the gin context under which the id of the request is stored.
+const requestIDKey = "request_id"
+
+// Returns a middleware that assigns an id to every request, the X-Request-ID header of the request when present or a
+// new random UUID otherwise. The id is stored in the gin context, for the handlers and the access log, and sent back
+// in the X-Request-ID header of the response.
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(requestContext *gin.Context) {
+		id := newRequestID(requestContext.Request)
+		requestContext.Set(requestIDKey, id)
+		requestContext.Header(requestIDHeader, id)
+		requestContext.Next()
+	}
+}
+
+// Returns the id assigned to the request by the request id middleware.
+func requestID(requestContext *gin.Context) string {
+	return requestContext.GetString(requestIDKey)
+}
+
+// Returns the id of a request, which is its X-Request-ID header when present or a new random UUID otherwise.
+func newRequestID(request *http.Request) string {
+	if id := request.Header.Get(requestIDHeader); id != "" {
+		return id
+	}
+	return uuid.NewString()
+}
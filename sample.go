@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// A matcher of a label selector, matching the alerts whose label name equals, or with negate differs from, value. A
+// missing label matches as the empty value.
+type labelMatcher struct {
+	name   string
+	value  string
+	negate bool
+}
+
+// Label selector, matching the alerts matched by all of its matchers.
+type labelSelector []labelMatcher
+
+var (
+	// The selector of the alerts that are never sampled out, parsed from the sample-exempt-selector flag. Nil when no
+	// alert is exempt.
+	sampleExemptAlerts labelSelector
+
+	sampledOutAlerts = metricsFactory.NewCounter(prometheus.CounterOpts{
+		Name: "alerts_sampled_out_total",
+		Help: "Total number of alerts not forwarded because they were sampled out",
+	})
+)
+
+// Parses a comma separated list of label matchers, like severity=critical,team!=ops, into a label selector. Returns
+// nil when the list is empty.
+func parseLabelSelector(value string) (labelSelector, error) {
+	var selector labelSelector
+	for _, item := range splitList(value) {
+		negate := false
+		name, matchValue, ok := strings.Cut(item, "!=")
+		if ok {
+			negate = true
+		} else if name, matchValue, ok = strings.Cut(item, "="); !ok {
+			return nil, fmt.Errorf("matcher [%s] is neither name=value nor name!=value", item)
+		}
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("matcher [%s] has no label name", item)
+		}
+		selector = append(selector, labelMatcher{name: name, value: strings.TrimSpace(matchValue), negate: negate})
+	}
+	return selector, nil
+}
+
+// Returns whether the labels match all the matchers of the selector. An empty selector matches every label set.
+func (s labelSelector) matches(labels map[string]string) bool {
+	for _, matcher := range s {
+		if (labels[matcher.name] == matcher.value) == matcher.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns whether the alert is sampled out with the given rate, the fraction of the alerts kept. The alerts matching
+// the exempt selector are always kept. With byFingerprint the decision is derived from the fingerprint of the labels
+// instead of drawn at random, so the same alert is always either kept or sampled out, across the repeats and retries
+// of its webhook and across the replicas.
+func sampledOut(alert Alert, rate float64, byFingerprint bool) bool {
+	if rate >= 1 || (sampleExemptAlerts != nil && sampleExemptAlerts.matches(alert.Labels)) {
+		return false
+	}
+	draw := rand.Float64()
+	if byFingerprint {
+		hash, _ := strconv.ParseUint(fingerprint(alert.Labels), 16, 64)
+		draw = float64(hash) / (math.MaxUint64 + 1.0)
+	}
+	return draw >= rate
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Whether a termination signal was received. From then on the readiness probe fails.
+var shuttingDown atomic.Bool
+
+// Blocks until a termination signal is received and then shuts the servers down gracefully. First the readiness probe
+// starts failing for the pre-shutdown delay, so that the load balancers stop routing new webhooks to this instance,
+// and only then the servers stop accepting connections and wait, all at once, up to the shutdown timeout for the
+// requests in flight to finish. Each server is shut down by one of the given functions, like http.Server.Shutdown.
+func waitForShutdown(preShutdownDelay, shutdownTimeout time.Duration, shutdowns ...func(context.Context) error) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	received := <-signals
+
+	log.Infof("received %s, failing readiness for %s before shutting down", received, preShutdownDelay)
+	shuttingDown.Store(true)
+	time.Sleep(preShutdownDelay)
+
+	log.Infof("shutting down the server")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, shutdown := range shutdowns {
+		wg.Add(1)
+		go func(shutdown func(context.Context) error) {
+			defer wg.Done()
+			if err := shutdown(ctx); err != nil {
+				log.Errorf("the server could not be shut down gracefully: %s", err)
+			}
+		}(shutdown)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-stomp/stomp"
+	"github.com/go-stomp/stomp/frame"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	stompOpenConnections = metricsFactory.NewGauge(prometheus.GaugeOpts{
+		Name: "stomp_open_connections",
+		Help: "Number of connections to the broker currently open.",
+	})
+	stompBrokerErrors = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "stomp_broker_errors_total",
+		Help: "Total number of ERROR frames received from the stomp server, by their message",
+	}, []string{"reason"})
+	stompBrokerInfo = metricsFactory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "stomp_broker_info",
+		Help: "A metric with a constant '1' value labeled by the address of the stomp server and the server it reported on the last connection.",
+	}, []string{"addr", "server"})
+)
+
+// Longest reason an ERROR frame is counted with, as the messages of some brokers are long and carry details, like the
+// destination, that would make too many series.
+const maxBrokerErrorReasonLength = 64
+
+// Header ActiveMQ Artemis reads the routing type of the destination of a SEND frame from, ANYCAST for a queue or
+// MULTICAST for a topic, when the destination is not prefixed according to the configuration of its acceptor.
+const artemisRoutingTypeHeader = "destination-type"
+
+// Forwarder that publishes the messages to a stomp server, like ActiveMQ. A new connection is opened for each message.
+type stompForwarder struct {
+	addr            string
+	user            string
+	pass            string
+	vhost           string
+	clientID        string
+	transport       string
+	version         string
+	writeTimeout    time.Duration
+	tcpKeepAlive    time.Duration
+	noContentLength bool
+	routingType     string
+
+	// The server reported by the stomp server on the last connection, guarded by mu, and whether there was any.
+	mu          sync.Mutex
+	server      string
+	serverKnown bool
+}
+
+// Creates a forwarder that publishes to the stomp server listening on addr, authenticating with the given credentials,
+// or anonymously when both are empty, in the given virtual host, or in the one named after the host of the server when
+// empty. With the tcp transport addr is a host:port, with the ws transport it's the ws:// or wss:// url of the
+// websocket. The client id, when not empty, is sent in the client-id header when connecting. The given stomp version
+// is the only one accepted when connecting, or the library negotiates it with the server when it's auto. Every write
+// to the connection, heart-beats included, fails if it takes longer than writeTimeout, 0 for no limit. The TCP
+// keep-alive probes of the connections are sent every tcpKeepAlive, or with the default period when 0. The messages
+// are sent without the content-length header when noContentLength is set. The routing type, anycast or multicast, is
+// sent uppercased in the destination-type header of the messages for ActiveMQ Artemis, none when empty.
+func newStompForwarder(addr, user, pass, vhost, clientID, transport, version string, writeTimeout time.Duration,
+	tcpKeepAlive time.Duration, noContentLength bool, routingType string) *stompForwarder {
+	return &stompForwarder{
+		addr:            addr,
+		user:            user,
+		pass:            pass,
+		vhost:           vhost,
+		clientID:        clientID,
+		transport:       transport,
+		version:         version,
+		writeTimeout:    writeTimeout,
+		tcpKeepAlive:    tcpKeepAlive,
+		noContentLength: noContentLength,
+		routingType:     routingType,
+	}
+}
+
+// Connection that sets a write deadline before each write, so a write blocked on a half-open connection fails instead
+// of hanging forever. It remembers whether any write timed out.
+type deadlineConn struct {
+	net.Conn
+	timeout  time.Duration
+	timedOut atomic.Bool
+}
+
+// Writes b to the connection, failing if it doesn't complete within the timeout of the connection.
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	if err := c.Conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	n, err := c.Conn.Write(b)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		c.timedOut.Store(true)
+	}
+	return n, err
+}
+
+// Connection tracked in the open connections gauge from the moment it's opened until it's first closed.
+type countedConn struct {
+	net.Conn
+	closeOnce sync.Once
+}
+
+// Counts a newly opened connection in the open connections gauge.
+func newCountedConn(conn net.Conn) *countedConn {
+	stompOpenConnections.Inc()
+	return &countedConn{Conn: conn}
+}
+
+// Closes the connection, removing it from the open connections gauge the first time.
+func (c *countedConn) Close() error {
+	c.closeOnce.Do(stompOpenConnections.Dec)
+	return c.Conn.Close()
+}
+
+// Opens a new connection to the stomp server with the configured credentials. The connection is closed as soon as ctx
+// is done, which aborts any connect or send in progress. The returned function must be called once the connection is
+// no longer used.
+func (f *stompForwarder) dial(ctx context.Context) (*stomp.Conn, *deadlineConn, func(), error) {
+	netConn, err := f.dialTransport(ctx)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: %w", errConnect, err)
+	}
+	netConn = newCountedConn(netConn)
+
+	var writeConn *deadlineConn
+	if f.writeTimeout > 0 {
+		writeConn = &deadlineConn{Conn: netConn, timeout: f.writeTimeout}
+		netConn = writeConn
+	}
+
+	var options []func(*stomp.Conn) error
+	if f.user != "" || f.pass != "" {
+		options = append(options, stomp.ConnOpt.Login(f.user, f.pass))
+	}
+	if f.vhost != "" {
+		options = append(options, stomp.ConnOpt.Host(f.vhost))
+	}
+	if f.clientID != "" {
+		options = append(options, stomp.ConnOpt.Header("client-id", f.clientID))
+	}
+	if f.version != "auto" {
+		options = append(options, stomp.ConnOpt.AcceptVersion(stomp.Version(f.version)))
+	}
+
+	stop := closeOnDone(ctx, netConn)
+	stompConn, err := stomp.Connect(netConn, options...)
+	if err != nil {
+		stop()
+		_ = netConn.Close()
+		return nil, nil, nil, fmt.Errorf("%w: %w", errConnect, contextError(ctx, f.brokerError(err)))
+	}
+	if f.version != "auto" && string(stompConn.Version()) != f.version {
+		_ = stompConn.MustDisconnect()
+		stop()
+		return nil, nil, nil, fmt.Errorf("%w: the server negotiated stomp version [%s] instead of [%s]", errConnect,
+			stompConn.Version(), f.version)
+	}
+	log.Debugf("negotiated stomp version [%s] with [%s], server [%s], session [%s]", stompConn.Version(), f.addr,
+		stompConn.Server(), stompConn.Session())
+	f.recordServer(stompConn.Server())
+	return stompConn, writeConn, stop, nil
+}
+
+// Records the server the stomp server reported in the CONNECTED frame, like ActiveMQ/5.18.2, in the broker info,
+// replacing the one of the previous connection when it changed, as when the broker was upgraded.
+func (f *stompForwarder) recordServer(server string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.serverKnown && f.server == server {
+		return
+	}
+	if f.serverKnown {
+		stompBrokerInfo.DeleteLabelValues(f.addr, f.server)
+	}
+	stompBrokerInfo.WithLabelValues(f.addr, server).Set(1)
+	f.server, f.serverKnown = server, true
+}
+
+// Returns whether the stomp server at addr, a host:port or a websocket url, is on the local host.
+func localStompAddr(addr string) bool {
+	host := addr
+	if parsed, err := url.Parse(addr); err == nil && parsed.Host != "" {
+		host = parsed.Hostname()
+	} else if splitHost, _, err := net.SplitHostPort(addr); err == nil {
+		host = splitHost
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Opens the connection the stomp frames are exchanged over, either a tcp connection or a websocket. The TCP keep-alive
+// is set on the tcp connection underneath, before the TLS of a wss websocket wraps it.
+func (f *stompForwarder) dialTransport(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{KeepAlive: f.tcpKeepAlive}
+	if f.transport == "ws" {
+		wsDialer := *websocket.DefaultDialer
+		wsDialer.Subprotocols = stompSubprotocols
+		wsDialer.NetDialContext = dialer.DialContext
+		wsConn, response, err := wsDialer.DialContext(ctx, f.addr, nil)
+		if response != nil {
+			_ = response.Body.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &websocketConn{Conn: wsConn}, nil
+	}
+
+	return dialer.DialContext(ctx, "tcp", f.addr)
+}
+
+// Returns err along with the body of the ERROR frame the stomp server answered with, when it's the cause of err, like
+// a failed login or a destination the user can't send to, logging the frame and counting it by its message. The rest
+// of the errors are returned as they are.
+func (f *stompForwarder) brokerError(err error) error {
+	var stompErr stomp.Error
+	if !errors.As(err, &stompErr) || stompErr.Frame == nil || stompErr.Frame.Command != frame.ERROR {
+		return err
+	}
+	reason := stompErr.Message
+	if len(reason) > maxBrokerErrorReasonLength {
+		reason = strings.ToValidUTF8(reason[:maxBrokerErrorReasonLength], "")
+	}
+	stompBrokerErrors.WithLabelValues(reason).Inc()
+
+	body := strings.TrimSpace(string(stompErr.Frame.Body))
+	log.WithField("server", f.addr).WithField("reason", stompErr.Message).WithField("body", body).
+		Error("the stomp server answered with an ERROR frame")
+	if body == "" {
+		return err
+	}
+	return fmt.Errorf("%w: %s", err, body)
+}
+
+// Returns errWriteTimeout wrapping err when a write to conn timed out, or err otherwise.
+func writeTimeoutError(conn *deadlineConn, err error) error {
+	if err != nil && conn != nil && conn.timedOut.Load() {
+		return fmt.Errorf("%w: %w", errWriteTimeout, err)
+	}
+	return err
+}
+
+// Key of the context value recording whether the broker acknowledged the receipt of the sends.
+type receiptKey struct{}
+
+// Returns a context under which the stomp sends record in the returned flag whether the broker acknowledged their
+// receipt, which is only requested with a write timeout.
+func withReceiptRecord(ctx context.Context) (context.Context, *atomic.Bool) {
+	acknowledged := &atomic.Bool{}
+	return context.WithValue(ctx, receiptKey{}, acknowledged), acknowledged
+}
+
+// Sends the body to the topic in a SEND frame. The content-type header is used as the content type of the frame and
+// the rest of the headers are added as they are, along with the destination-type header of the routing type unless the
+// headers already carry one. When a write timeout is set, a receipt is requested for the frame, so
+// a write that fails or times out is reported by the send itself and the connection is dropped right away.
+func (f *stompForwarder) Send(ctx context.Context, topic string, _ string, body []byte, headers map[string]string) error {
+	stompConn, writeConn, stop, err := f.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	var options []func(*frame.Frame) error
+	for _, name := range sortedHeaderNames(headers) {
+		if name != frame.ContentType {
+			options = append(options, stomp.SendOpt.Header(name, headers[name]))
+		}
+	}
+	if _, ok := headers[artemisRoutingTypeHeader]; !ok && f.routingType != "" {
+		options = append(options, stomp.SendOpt.Header(artemisRoutingTypeHeader, strings.ToUpper(f.routingType)))
+	}
+	if writeConn != nil {
+		options = append(options, stomp.SendOpt.Receipt)
+	}
+	if f.noContentLength {
+		options = append(options, stomp.SendOpt.NoContentLength)
+	}
+
+	sendStart := time.Now()
+	err = stompConn.Send(topic, headers[frame.ContentType], body, options...)
+	observeSend(ctx, sendStart, err)
+	if err != nil {
+		_ = stompConn.MustDisconnect()
+		return contextError(ctx, writeTimeoutError(writeConn, f.brokerError(err)))
+	}
+	// With a receipt requested, the send only returns once the broker acknowledged it.
+	if acknowledged, ok := ctx.Value(receiptKey{}).(*atomic.Bool); ok && writeConn != nil {
+		acknowledged.Store(true)
+	}
+
+	return contextError(ctx, writeTimeoutError(writeConn, f.brokerError(stompConn.Disconnect())))
+}
+
+// Connects to the stomp server and disconnects right away.
+func (f *stompForwarder) Check(ctx context.Context) error {
+	stompConn, writeConn, stop, err := f.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	return contextError(ctx, writeTimeoutError(writeConn, stompConn.Disconnect()))
+}
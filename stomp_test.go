@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"github.com/go-stomp/stomp/frame"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Fake stomp server listening on the loopback interface, recording the frames it reads. It answers the CONNECT frames
+// with a CONNECTED one and every frame requesting a receipt with a RECEIPT one.
+type fakeBroker struct {
+	listener net.Listener
+	mu       sync.Mutex
+	frames   []*frame.Frame
+	// When set, the connections are closed right after reading a SEND frame, as when the broker dies mid-send.
+	dropAfterSend atomic.Bool
+}
+
+// Starts a fake stomp server, stopped at the end of the test.
+func newFakeBroker(t *testing.T) *fakeBroker {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %s", err)
+	}
+	broker := &fakeBroker{listener: listener}
+	t.Cleanup(func() { _ = listener.Close() })
+	go broker.serve()
+	return broker
+}
+
+// Returns the host:port the fake stomp server listens on.
+func (b *fakeBroker) addr() string {
+	return b.listener.Addr().String()
+}
+
+func (b *fakeBroker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *fakeBroker) handle(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	reader := frame.NewReader(conn)
+	writer := frame.NewWriter(conn)
+	for {
+		received, err := reader.Read()
+		if err != nil {
+			return
+		}
+		if received == nil {
+			// A heart-beat.
+			continue
+		}
+		b.mu.Lock()
+		b.frames = append(b.frames, received)
+		b.mu.Unlock()
+
+		var reply *frame.Frame
+		switch received.Command {
+		case frame.CONNECT, frame.STOMP:
+			reply = frame.New(frame.CONNECTED, frame.Version, "1.2", frame.Server, "fake/1.0")
+		case frame.SEND:
+			if b.dropAfterSend.Load() {
+				return
+			}
+		}
+		if receipt, ok := received.Header.Contains(frame.Receipt); ok {
+			reply = frame.New(frame.RECEIPT, frame.ReceiptId, receipt)
+		}
+		if reply != nil {
+			if err := writer.Write(reply); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Returns the frames read so far with the given command.
+func (b *fakeBroker) received(command string) []*frame.Frame {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var frames []*frame.Frame
+	for _, received := range b.frames {
+		if received.Command == command {
+			frames = append(frames, received)
+		}
+	}
+	return frames
+}
+
+func TestStompVirtualHost(t *testing.T) {
+	tests := []struct {
+		name  string
+		vhost string
+		want  string
+	}{
+		{name: "custom", vhost: "/production", want: "/production"},
+		{name: "default", vhost: "", want: "127.0.0.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker := newFakeBroker(t)
+			stompForwarder := newStompForwarder(broker.addr(), "user", "pass", test.vhost, "", "tcp", "auto", 0, 0,
+				false, "")
+			if err := stompForwarder.Check(context.Background()); err != nil {
+				t.Fatalf("connecting to the fake broker: %s", err)
+			}
+			connects := broker.received(frame.CONNECT)
+			if len(connects) != 1 {
+				t.Fatalf("got %d CONNECT frames, want 1", len(connects))
+			}
+			if host := connects[0].Header.Get(frame.Host); host != test.want {
+				t.Errorf("host header = %q, want %q", host, test.want)
+			}
+		})
+	}
+}
+
+func TestStompNoContentLength(t *testing.T) {
+	tests := []struct {
+		name            string
+		noContentLength bool
+		want            bool
+	}{
+		{name: "default", noContentLength: false, want: true},
+		{name: "suppressed", noContentLength: true, want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker := newFakeBroker(t)
+			stompForwarder := newStompForwarder(broker.addr(), "", "", "", "", "tcp", "auto", 0, 0,
+				test.noContentLength, "")
+			err := stompForwarder.Send(context.Background(), "/queue/alerts", "", []byte(`{"status":"firing"}`),
+				map[string]string{frame.ContentType: "application/json"})
+			if err != nil {
+				t.Fatalf("sending to the fake broker: %s", err)
+			}
+			sends := broker.received(frame.SEND)
+			if len(sends) != 1 {
+				t.Fatalf("got %d SEND frames, want 1", len(sends))
+			}
+			if _, ok := sends[0].Header.Contains(frame.ContentLength); ok != test.want {
+				t.Errorf("content-length header present = %t, want %t", ok, test.want)
+			}
+			if body := string(sends[0].Body); body != `{"status":"firing"}` {
+				t.Errorf("body = %q, want the json of the alert", body)
+			}
+		})
+	}
+}
+
+func TestStompRoutingType(t *testing.T) {
+	tests := []struct {
+		name        string
+		routingType string
+		headers     map[string]string
+		want        string
+	}{
+		{name: "anycast", routingType: "anycast", want: "ANYCAST"},
+		{name: "multicast", routingType: "multicast", want: "MULTICAST"},
+		{name: "none", routingType: "", want: ""},
+		{name: "already set", routingType: "anycast", headers: map[string]string{artemisRoutingTypeHeader: "MULTICAST"},
+			want: "MULTICAST"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker := newFakeBroker(t)
+			stompForwarder := newStompForwarder(broker.addr(), "", "", "", "", "tcp", "auto", 0, 0, false,
+				test.routingType)
+			if err := stompForwarder.Send(context.Background(), "/queue/alerts", "", []byte(`{}`),
+				test.headers); err != nil {
+				t.Fatalf("sending to the fake broker: %s", err)
+			}
+			sends := broker.received(frame.SEND)
+			if len(sends) != 1 {
+				t.Fatalf("got %d SEND frames, want 1", len(sends))
+			}
+			values := sends[0].Header.GetAll(artemisRoutingTypeHeader)
+			if test.want == "" {
+				if len(values) != 0 {
+					t.Errorf("destination-type headers = %q, want none", values)
+				}
+				return
+			}
+			if len(values) != 1 || values[0] != test.want {
+				t.Errorf("destination-type headers = %q, want [%q]", values, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// Checks the startsAt and endsAt timestamps of the alerts are RFC3339 timestamps and, when normalize is set, rewrites
+// the valid ones to their canonical UTC form, so that consumers get the same format whatever the sender used. Empty
+// timestamps are valid and left as they are. The invalid timestamps are logged, left untouched, and counted in the
+// returned value, with the fields of the given logger.
+func checkTimestamps(logger *logrus.Entry, alerts []Alert, normalize bool) (invalid int) {
+	for i := range alerts {
+		alert := &alerts[i]
+		for _, timestamp := range []struct {
+			name  string
+			value *string
+		}{
+			{name: "startsAt", value: &alert.StartsAt},
+			{name: "endsAt", value: &alert.EndsAt},
+		} {
+			normalized, err := normalizeTimestamp(*timestamp.value)
+			if err != nil {
+				invalid++
+				logger.WithField("alertname", alert.Labels["alertname"]).Warnf("invalid %s timestamp [%s]: %s",
+					timestamp.name, *timestamp.value, err)
+				continue
+			}
+			if normalize {
+				*timestamp.value = normalized
+			}
+		}
+	}
+	return invalid
+}
+
+// Returns the RFC3339 timestamp in UTC, or an error when it can't be parsed. An empty timestamp is returned as it is.
+func normalizeTimestamp(value string) (string, error) {
+	if value == "" {
+		return value, nil
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return value, err
+	}
+	return parsed.UTC().Format(time.RFC3339Nano), nil
+}
+
+// Returns whether the alert is resolved and ended longer than maxAge before now. Alerts whose end can't be parsed are
+// never stale.
+func staleAlert(alert Alert, maxAge time.Duration, now time.Time) bool {
+	endsAt, err := time.Parse(time.RFC3339Nano, alert.EndsAt)
+	if err != nil || endsAt.IsZero() || endsAt.After(now) {
+		return false
+	}
+	return now.Sub(endsAt) > maxAge
+}
+
+// Returns the time elapsed from the start of the alert to now, or false when its start can't be parsed.
+func alertAge(alert Alert, now time.Time) (time.Duration, bool) {
+	startsAt, err := time.Parse(time.RFC3339Nano, alert.StartsAt)
+	if err != nil || startsAt.IsZero() {
+		return 0, false
+	}
+	return now.Sub(startsAt), true
+}
+
+// Returns the status of the alert, the one it carries, as Alertmanager sets it, or when it carries none, or neither
+// firing nor resolved, resolved when it ended before now and firing otherwise, so the status labels stay bounded.
+func alertStatus(alert Alert, now time.Time) string {
+	if alert.Status == "firing" || alert.Status == "resolved" {
+		return alert.Status
+	}
+	endsAt, err := time.Parse(time.RFC3339Nano, alert.EndsAt)
+	if err != nil || endsAt.IsZero() || endsAt.After(now) {
+		return "firing"
+	}
+	return "resolved"
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"os"
+	"strconv"
+)
+
+// The config of a topic whose messages are sent with settings of their own: to another stomp server, with other
+// credentials, or persisted or not by the broker. The unset settings are the ones of the flags.
+type topicConfig struct {
+	Topic      string `yaml:"topic"`
+	StompAddr  string `yaml:"stomp_addr"`
+	StompUser  string `yaml:"stomp_user"`
+	StompPass  string `yaml:"stomp_pass"`
+	Persistent *bool  `yaml:"persistent"`
+}
+
+// The file holding the configs of the topics.
+type topicsConfig struct {
+	Topics []topicConfig `yaml:"topics"`
+}
+
+// The settings the messages of a topic are sent with instead of the ones of the flags.
+type topicOverride struct {
+	// The forwarder of the stomp server and credentials of the topic, nil when they are the ones of the flags.
+	forwarder Forwarder
+	// Whether the broker persists the messages, nil to leave it to the broker.
+	persistent *bool
+}
+
+// The overrides of the topics loaded from the topics file, by topic. Nil when there is no topics file.
+var topicOverrides map[string]topicOverride
+
+// Loads the configs of the topics from the yaml file at path, returning the override of each topic. The topics must be
+// unique valid destinations and their stomp server and credentials can only be set with the stomp backend, without a
+// write-ahead log, as its replays only go to the stomp server of the flags. The topics sharing a stomp server and
+// credentials share a forwarder.
+func loadTopics(path string) (map[string]topicOverride, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file topicsConfig
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, err
+	}
+
+	overrides := map[string]topicOverride{}
+	forwarders := map[[3]string]Forwarder{}
+	for i, config := range file.Topics {
+		if !validDestination(config.Topic) {
+			return nil, fmt.Errorf("topic %d [%s] is not a valid destination", i+1, config.Topic)
+		}
+		if _, ok := overrides[config.Topic]; ok {
+			return nil, fmt.Errorf("topic %d [%s] is already configured", i+1, config.Topic)
+		}
+		override := topicOverride{persistent: config.Persistent}
+		if config.StompAddr != "" || config.StompUser != "" || config.StompPass != "" {
+			if *backend != "stomp" {
+				return nil, fmt.Errorf("topic %d [%s] sets a stomp server with the %s backend", i+1, config.Topic,
+					*backend)
+			}
+			if *walDir != "" {
+				return nil, fmt.Errorf("topic %d [%s] sets a stomp server, whose messages can't go through the "+
+					"write-ahead log of --wal-dir", i+1, config.Topic)
+			}
+			connection := topicConnection(config)
+			if forwarders[connection] == nil {
+				forwarders[connection] = newStompForwarderTo(connection[0], connection[1], connection[2])
+			}
+			override.forwarder = forwarders[connection]
+		}
+		overrides[config.Topic] = override
+	}
+	return overrides, nil
+}
+
+// Returns the address, user and password of the stomp server the messages of the topic are sent to, the ones of the
+// flags for those the topic doesn't set.
+func topicConnection(config topicConfig) [3]string {
+	return stompConnection(config.StompAddr, config.StompUser, config.StompPass)
+}
+
+// Returns the address, user and password of a stomp server given its address and credentials, taking the ones of the
+// flags when they are empty, without credentials under --stomp-anonymous. The credentials are taken as a pair, so a
+// user without a password isn't given the password of the flags.
+func stompConnection(addr, user, pass string) [3]string {
+	connection := [3]string{*stompAddr, *stompUser, *stompPass}
+	if *stompAnonymous {
+		connection[1], connection[2] = "", ""
+	}
+	if addr != "" {
+		connection[0] = addr
+	}
+	if user != "" || pass != "" {
+		connection[1], connection[2] = user, pass
+	}
+	return connection
+}
+
+// Returns the forwarder the messages of the topic are sent through under ctx, the one of the topic when it has a stomp
+// server or credentials of its own, or the one of forwarderOf otherwise, and whether it's the one of the configured
+// backend.
+func topicForwarder(ctx context.Context, topic string) (Forwarder, bool) {
+	if override, ok := topicOverrides[topic]; ok && override.forwarder != nil {
+		return override.forwarder, false
+	}
+	return forwarderOf(ctx)
+}
+
+// Sets the headers of the settings of the topic, if any, in the headers of a message.
+func addTopicHeaders(topic string, headers map[string]string) {
+	if override, ok := topicOverrides[topic]; ok && override.persistent != nil {
+		headers["persistent"] = strconv.FormatBool(*override.persistent)
+	}
+}
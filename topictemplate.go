@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// The template of the topic of each alert, parsed from the topic-template flag, nil when the alerts are sent to the
+// topic posted to.
+var topicTemplate *template.Template
+
+// Whether the failing topic and header templates fail the alerts instead of being logged, set by the render command so
+// that a broken template exits with an error rather than a warning easily lost among the output.
+var strictTemplates bool
+
+// Parses the template of the topic of the alerts, executed with the alert as data, like {{ .Labels.team }}. Returns
+// nil when it's empty.
+func parseTopicTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	return template.New("topic").Option("missingkey=zero").Parse(text)
+}
+
+// Returns the topic the alert is sent to, the topic template executed with the alert, sanitized, or the topic posted
+// to when there is no template or it renders empty or fails, which is logged with the fields of the given logger.
+// Under strictTemplates a failing template returns an error instead.
+func alertTopic(logger *logrus.Entry, alert Alert, topic string) (string, error) {
+	if topicTemplate == nil {
+		return topic, nil
+	}
+	rendered, err := executeAlertTemplate(topicTemplate, alert)
+	if err != nil {
+		if strictTemplates {
+			return "", fmt.Errorf("topic template failed: %w", err)
+		}
+		logger.WithField("alertname", alert.Labels["alertname"]).
+			Warnf("the topic template failed, sending the alert to [%s]: %s", topic, err)
+		return topic, nil
+	}
+	templated := sanitizeTopic(rendered)
+	if templated == "" {
+		logger.WithField("alertname", alert.Labels["alertname"]).
+			Debugf("the topic template rendered empty, sending the alert to [%s]", topic)
+		return topic, nil
+	}
+	return templated, nil
+}
+
+// Executes a template with the alert as data, returning what it renders without the spaces around it. The rendered
+// values of the missing annotations, <no value>, are dropped, as the missing labels render empty.
+func executeAlertTemplate(tmpl *template.Template, alert Alert) (string, error) {
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, alert); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.ReplaceAll(rendered.String(), "<no value>", "")), nil
+}
+
+// Sanitizes a rendered topic into a valid destination, replacing its spaces and control characters with underscores.
+func sanitizeTopic(topic string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, topic)
+}
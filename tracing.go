@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// The tracer used for every span of the application. Until setupTracing installs a tracer provider it falls back to
+// the global no-op provider, so spans cost nothing when tracing is disabled.
+var tracer = otel.Tracer("alertmanager-stomp-forwarder")
+
+// Installs a tracer provider that exports the spans through OTLP/gRPC to the given endpoint, and the W3C trace context
+// propagator so that incoming traceparent headers are honored. When the endpoint is empty tracing is left disabled.
+// The returned function flushes and stops the exporter.
+func setupTracing(endpoint string, insecure bool) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+	if insecure {
+		options = append(options, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(context.Background(), options...)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName("alertmanager-stomp-forwarder"),
+			semconv.ServiceVersion(version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// Middleware that starts a server span for each request, continuing the trace of the caller when the request carries
+// a traceparent header. The span is stored in the request context so handlers can create child spans from it.
+func tracingMiddleware() gin.HandlerFunc {
+	return func(requestContext *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(requestContext.Request.Context(),
+			propagation.HeaderCarrier(requestContext.Request.Header))
+		ctx, span := tracer.Start(ctx, requestContext.Request.Method+" "+requestContext.FullPath(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethod(requestContext.Request.Method),
+				semconv.HTTPRoute(requestContext.FullPath()),
+			))
+		defer span.End()
+
+		requestContext.Request = requestContext.Request.WithContext(ctx)
+		requestContext.Next()
+
+		status := requestContext.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
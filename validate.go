@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// Error rejecting the alerts of a payload, along with the http status the webhook is answered with.
+type payloadError struct {
+	status  int
+	message string
+}
+
+func (e *payloadError) Error() string {
+	return e.message
+}
+
+// Validates the alerts of a payload, shared by the webhook, the gRPC service and the render command: the number of
+// alerts, the payload version and the timestamps of the alerts, normalizing them if configured. The alerts beyond the
+// maximum per request are dropped, unless it rejects them, and so are all of them when the whole group is resolved and
+// only firing groups are forwarded. Returns the number of alerts skipped, with their dispositions under debug mode, and
+// whether the alerts left are to be forwarded, or a *payloadError when the payload is rejected. The outcome is logged
+// with the fields of the given logger.
+func validatePayload(logger *logrus.Entry, alerts *Alerts) (skipped int, dispositions alertDispositions,
+	forward bool, err error) {
+	if len(alerts.Alerts) == 0 {
+		emptyBatches.Inc()
+		if *rejectEmptyBatches {
+			logger.Errorf("rejecting the request, it holds no alerts")
+			return 0, nil, false, &payloadError{status: http.StatusBadRequest, message: "no alerts"}
+		}
+		logger.Warnf("the request holds no alerts")
+	}
+	if *maxAlertsPerRequest > 0 && len(alerts.Alerts) > *maxAlertsPerRequest {
+		oversizedBatches.WithLabelValues(*maxAlertsAction).Inc()
+		if *maxAlertsAction == "reject" {
+			logger.Errorf("rejecting the request, it holds %d alerts, more than the maximum of %d", len(alerts.Alerts),
+				*maxAlertsPerRequest)
+			return 0, nil, false, &payloadError{status: http.StatusRequestEntityTooLarge,
+				message: fmt.Sprintf("more than %d alerts", *maxAlertsPerRequest)}
+		}
+		logger.Warnf("the request holds %d alerts, only the first %d are forwarded", len(alerts.Alerts),
+			*maxAlertsPerRequest)
+		skipped += len(alerts.Alerts) - *maxAlertsPerRequest
+		dispositions.addAll(alerts.Alerts[*maxAlertsPerRequest:], actionDropped,
+			fmt.Sprintf("beyond the maximum of %d alerts per request", *maxAlertsPerRequest))
+		alerts.Alerts = alerts.Alerts[:*maxAlertsPerRequest]
+	}
+	logger.WithField("group_key", alerts.GroupKey).Debugf("received %d alerts with payload version [%s]",
+		len(alerts.Alerts), alerts.Version)
+	if alerts.Version != payloadVersion {
+		if *strictPayloadVersion {
+			logger.Errorf("rejecting the request, unsupported payload version [%s]", alerts.Version)
+			return 0, nil, false, &payloadError{status: http.StatusBadRequest,
+				message: fmt.Sprintf("unsupported payload version [%s]", alerts.Version)}
+		}
+		logger.Warnf("unexpected payload version [%s], expected [%s]", alerts.Version, payloadVersion)
+	}
+	if *normalizeTimestamps || *invalidTimestamps == "reject" {
+		invalid := checkTimestamps(logger, alerts.Alerts, *normalizeTimestamps)
+		if invalid > 0 && *invalidTimestamps == "reject" {
+			logger.Errorf("rejecting the request, it holds %d invalid timestamps", invalid)
+			return 0, nil, false, &payloadError{status: http.StatusBadRequest,
+				message: fmt.Sprintf("%d invalid timestamps", invalid)}
+		}
+	}
+	if *onlyFiringGroups && alerts.Status == "resolved" {
+		logger.Infof("alert group is resolved, skipping its %d alerts", len(alerts.Alerts))
+		dispositions.addAll(alerts.Alerts, actionDropped, "the group is resolved and only firing groups are forwarded")
+		return skipped + len(alerts.Alerts), dispositions, false, nil
+	}
+	return skipped, dispositions, true, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"runtime"
+)
+
+// Build metadata of the binary. These values are meant to be overridden at build time through the linker, e.g.
+// -ldflags "-X main.version=0.2 -X main.revision=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)".
+var (
+	version   = "dev"
+	revision  = "unknown"
+	buildDate = "unknown"
+
+	buildInfo = metricsFactory.NewGauge(prometheus.GaugeOpts{
+		Name: "forwarder_build_info",
+		Help: "A metric with a constant '1' value labeled by version, revision and goversion of the forwarder.",
+		ConstLabels: prometheus.Labels{
+			"version":   version,
+			"revision":  revision,
+			"goversion": runtime.Version(),
+		},
+	})
+)
+
+func init() {
+	buildInfo.Set(1)
+}
+
+// Returns the human readable version string printed by the --version flag.
+func versionString() string {
+	return fmt.Sprintf("alertmanager-stomp-forwarder, version %s (revision: %s, build date: %s, go: %s)",
+		version, revision, buildDate, runtime.Version())
+}
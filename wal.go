@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// Returned, wrapped along with the error of the send, when a message could not be sent to the broker but was kept
+	// in the write-ahead log to be sent later.
+	errQueued = errors.New("kept in the write-ahead log")
+
+	// Returned, wrapped, when a message could not be written to the write-ahead log because it's full.
+	errWALFull = errors.New("the write-ahead log is full")
+
+	walEntries = metricsFactory.NewGauge(prometheus.GaugeOpts{
+		Name: "wal_entries",
+		Help: "Number of messages in the write-ahead log waiting to be sent to the broker.",
+	})
+
+	walFull = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "wal_full_total",
+		Help: "Total number of messages that found the write-ahead log full, by the action taken",
+	}, []string{"action"})
+
+	walDeadLetters = metricsFactory.NewCounter(prometheus.CounterOpts{
+		Name: "wal_dead_letters_total",
+		Help: "Total number of messages of the write-ahead log moved to its dead-letter directory",
+	})
+)
+
+// The directory of the write-ahead log the messages that keep failing are moved to.
+const walDeadLetterDir = "dead-letter"
+
+// The policies applied to the messages that find the write-ahead log full.
+const (
+	// The message is not sent and its webhook is answered with a 503.
+	walFullReject = "reject"
+	// The message waits for the log to have room, as long as its webhook may take.
+	walFullBlock = "block"
+	// The oldest message of the log is dropped to make room for the message.
+	walFullDropOldest = "drop-oldest"
+)
+
+// The write-ahead log of the configured backend, nil when it's disabled.
+var messagesWAL *writeAheadLog
+
+// Key of the context value that makes the sends skip the write-ahead log.
+type skipWALKey struct{}
+
+// Returns a context under which the sends skip the write-ahead log, for the ones whose outcome must be reported as it
+// is, like the test alerts.
+func withoutWAL(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipWALKey{}, true)
+}
+
+// A message kept in the write-ahead log, with everything needed to send it again.
+type walEntry struct {
+	Topic   string            `json:"topic"`
+	Key     string            `json:"key"`
+	Body    []byte            `json:"body"`
+	Headers map[string]string `json:"headers"`
+}
+
+// Write-ahead log of the messages sent to the broker, a directory holding a file for each message. A message is
+// written to the log before it's sent and removed once the broker accepts it, so that the messages that couldn't be
+// sent, even across a crash, are sent again later. It holds at most size messages, applying the full policy to the
+// messages that find it full. The messages whose replays fail maxAttempts times for any other reason than the
+// connection to the broker are moved to its dead-letter directory, so they don't hold up the rest.
+type writeAheadLog struct {
+	mu          sync.Mutex
+	dir         string
+	size        int
+	fullPolicy  string
+	maxAttempts int
+	entries     int
+	sequence    atomic.Uint64
+	inFlight    map[string]bool
+	// The number of failed replays of the messages, by path.
+	attempts map[string]int
+	// Closed, and replaced, every time a message is removed from the log, waking up the messages waiting for room.
+	freed chan struct{}
+}
+
+// Opens the write-ahead log in the directory, creating it and its dead-letter directory if needed, along with the
+// messages left in it.
+func openWriteAheadLog(dir string, size int, fullPolicy string, maxAttempts int) (*writeAheadLog, error) {
+	if err := os.MkdirAll(filepath.Join(dir, walDeadLetterDir), 0o700); err != nil {
+		return nil, err
+	}
+	wal := &writeAheadLog{dir: dir, size: size, fullPolicy: fullPolicy, maxAttempts: maxAttempts,
+		inFlight: make(map[string]bool), attempts: make(map[string]int), freed: make(chan struct{})}
+	paths, err := wal.paths()
+	if err != nil {
+		return nil, err
+	}
+	wal.entries = len(paths)
+	walEntries.Set(float64(wal.entries))
+	return wal, nil
+}
+
+// Returns the paths of the messages in the log, the oldest first.
+func (w *writeAheadLog) paths() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(w.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Returns whether the log is full and rejects the messages that find it so.
+func (w *writeAheadLog) rejecting() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.fullPolicy == walFullReject && w.entries >= w.size
+}
+
+// Makes room in the log for a message, with w.mu held, applying the full policy when it's full: failing with
+// errWALFull, waiting until a message is removed or ctx is done, or dropping the oldest message not in flight. Returns
+// with w.mu held.
+func (w *writeAheadLog) makeRoom(ctx context.Context) error {
+	if w.entries < w.size {
+		return nil
+	}
+	switch w.fullPolicy {
+	case walFullBlock:
+		walFull.WithLabelValues("blocked").Inc()
+		for w.entries >= w.size {
+			freed := w.freed
+			w.mu.Unlock()
+			select {
+			case <-freed:
+			case <-ctx.Done():
+				w.mu.Lock()
+				walFull.WithLabelValues("timed_out").Inc()
+				return fmt.Errorf("%w, it holds %d messages: %w", errWALFull, w.size, ctx.Err())
+			}
+			w.mu.Lock()
+		}
+		return nil
+	case walFullDropOldest:
+		if err := w.dropOldest(); err != nil {
+			return err
+		}
+		walFull.WithLabelValues("evicted").Inc()
+		return nil
+	}
+	walFull.WithLabelValues("rejected").Inc()
+	return fmt.Errorf("%w, it holds %d messages", errWALFull, w.size)
+}
+
+// Drops the oldest message of the log that is not in flight, with w.mu held, so that the message being written takes
+// its place.
+func (w *writeAheadLog) dropOldest() error {
+	paths, err := w.paths()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if w.inFlight[path] {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		w.entries--
+		walEntries.Set(float64(w.entries))
+		log.Warnf("the write-ahead log is full, dropped its oldest message [%s]", path)
+		return nil
+	}
+	return fmt.Errorf("%w, all of its %d messages are being sent", errWALFull, w.size)
+}
+
+// Writes the message to the log, synced to disk, and returns its path. The message is in flight, not replayed, from
+// before it's written until it's removed or released. When the log is full, the full policy is applied first.
+func (w *writeAheadLog) append(ctx context.Context, entry walEntry) (string, error) {
+	w.mu.Lock()
+	if err := w.makeRoom(ctx); err != nil {
+		w.mu.Unlock()
+		return "", err
+	}
+	name := fmt.Sprintf("%020d-%010d", time.Now().UnixNano(), w.sequence.Add(1))
+	path := filepath.Join(w.dir, name+".json")
+	w.inFlight[path] = true
+	w.entries++
+	walEntries.Set(float64(w.entries))
+	w.mu.Unlock()
+
+	if err := w.write(path, entry); err != nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.inFlight, path)
+		w.removed()
+		return "", err
+	}
+	return path, nil
+}
+
+// Writes the message to a temporary file synced to disk and renames it to the path, so that a crash never leaves a
+// partial message in the log.
+func (w *writeAheadLog) write(path string, entry walEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(w.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(file.Name()) }()
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// Removes the message once the broker accepted it.
+func (w *writeAheadLog) remove(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.inFlight, path)
+	delete(w.attempts, path)
+	if err := os.Remove(path); err != nil {
+		log.Errorf("impossible to remove [%s] from the write-ahead log: %s", path, err)
+		return
+	}
+	w.removed()
+}
+
+// Accounts for a message that left the log, with w.mu held, waking up the messages waiting for room.
+func (w *writeAheadLog) removed() {
+	w.entries--
+	walEntries.Set(float64(w.entries))
+	close(w.freed)
+	w.freed = make(chan struct{})
+}
+
+// Leaves the message in the log to be replayed later.
+func (w *writeAheadLog) release(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.inFlight, path)
+}
+
+// Counts a failed replay of the message, leaving it in the log to be replayed later or, once its replays failed
+// maxAttempts times, moving it to the dead-letter directory.
+func (w *writeAheadLog) failed(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.inFlight, path)
+	w.attempts[path]++
+	if w.attempts[path] < w.maxAttempts {
+		return
+	}
+	delete(w.attempts, path)
+	deadLetter := filepath.Join(w.dir, walDeadLetterDir, filepath.Base(path))
+	if err := os.Rename(path, deadLetter); err != nil {
+		log.Errorf("impossible to move [%s] to the dead-letter directory of the write-ahead log: %s", path, err)
+		return
+	}
+	log.Errorf("the replays of the message [%s] of the write-ahead log failed %d times, moved it to [%s]", path,
+		w.maxAttempts, deadLetter)
+	walDeadLetters.Inc()
+	w.removed()
+}
+
+// Sends again, oldest first, the messages of the log that are not in flight through the forwarder, removing each of
+// them once the broker accepts it. Stops at the first one that fails to connect to the broker, as it's likely still
+// unreachable, while the ones that fail for any other reason, like a destination the user can't write to, are skipped
+// and moved to the dead-letter directory once they failed too many times.
+func (w *writeAheadLog) replay(forwarder Forwarder) {
+	paths, err := w.paths()
+	if err != nil {
+		log.Errorf("impossible to list the write-ahead log: %s", err)
+		return
+	}
+	replayed := 0
+	for _, path := range paths {
+		w.mu.Lock()
+		inFlight := w.inFlight[path]
+		if !inFlight {
+			w.inFlight[path] = true
+		}
+		w.mu.Unlock()
+		if inFlight {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		var entry walEntry
+		if err == nil {
+			err = json.Unmarshal(data, &entry)
+		}
+		if err != nil {
+			log.Errorf("dropping the unreadable message [%s] of the write-ahead log: %s", path, err)
+			w.remove(path)
+			continue
+		}
+
+		ctx, cancel := forwardContext(context.Background())
+		err = forwarder.Send(ctx, entry.Topic, entry.Key, entry.Body, entry.Headers)
+		cancel()
+		if errors.Is(err, errConnect) {
+			w.release(path)
+			log.WithField("topic", entry.Topic).Warnf("the messages of the write-ahead log could not be replayed, "+
+				"%d were sent: %s", replayed, err)
+			return
+		}
+		if err != nil {
+			log.WithField("topic", entry.Topic).Warnf("the message [%s] of the write-ahead log could not be "+
+				"replayed, skipping it: %s", path, err)
+			w.failed(path)
+			continue
+		}
+		w.remove(path)
+		replayed++
+	}
+	if replayed > 0 {
+		log.Infof("replayed %d messages of the write-ahead log", replayed)
+	}
+}
+
+// Replays the messages of the log right away, sending those left by a previous run, and then every interval.
+func (w *writeAheadLog) runReplays(forwarder Forwarder, interval time.Duration) {
+	w.replay(forwarder)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		w.replay(forwarder)
+	}
+}
+
+// Forwarder that writes every message to the write-ahead log before sending it through the wrapped forwarder. The
+// messages the broker accepts are removed from the log, the rest are kept to be replayed, failing with errQueued.
+type walForwarder struct {
+	Forwarder
+	wal *writeAheadLog
+}
+
+// Sends the body through the wrapped forwarder, keeping it in the write-ahead log when the send fails. The messages
+// that can't make room in the full log fail, while the ones that can't be written to it for any other reason are sent
+// without it, as are the ones ctx says to skip it.
+func (f *walForwarder) Send(ctx context.Context, topic string, key string, body []byte, headers map[string]string) error {
+	if ctx.Value(skipWALKey{}) != nil {
+		return f.Forwarder.Send(ctx, topic, key, body, headers)
+	}
+	path, err := f.wal.append(ctx, walEntry{Topic: topic, Key: key, Body: body, Headers: headers})
+	if errors.Is(err, errWALFull) {
+		return err
+	}
+	if err != nil {
+		log.WithField("topic", topic).Warnf("sending the message without the write-ahead log: %s", err)
+		return f.Forwarder.Send(ctx, topic, key, body, headers)
+	}
+
+	err = f.Forwarder.Send(ctx, topic, key, body, headers)
+	if err != nil {
+		f.wal.release(path)
+		return fmt.Errorf("%w: %w", errQueued, err)
+	}
+	f.wal.remove(path)
+	return nil
+}
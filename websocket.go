@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/gorilla/websocket"
+	"io"
+	"time"
+)
+
+// The websocket subprotocols of the stomp versions, offered to the server when opening the websocket.
+var stompSubprotocols = []string{"v12.stomp", "v11.stomp", "v10.stomp"}
+
+// Adapts a websocket to a net.Conn, so that stomp can be spoken over it. The bytes written are sent as text messages
+// and the messages received are read one after the other as a single stream, as stomp frames may span messages.
+type websocketConn struct {
+	*websocket.Conn
+	reader io.Reader
+}
+
+// Reads from the message being received, moving on to the next one once it's fully read.
+func (c *websocketConn) Read(b []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			_, reader, err := c.Conn.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			c.reader = reader
+		}
+		n, err := c.reader.Read(b)
+		if err == io.EOF {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// Sends b as a single text message.
+func (c *websocketConn) Write(b []byte) (int, error) {
+	if err := c.Conn.WriteMessage(websocket.TextMessage, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Sets both the read and the write deadlines of the websocket.
+func (c *websocketConn) SetDeadline(t time.Time) error {
+	if err := c.Conn.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.Conn.SetWriteDeadline(t)
+}